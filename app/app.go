@@ -19,20 +19,20 @@ package app
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"fyne.io/systray"
 	"github.com/manuel-koch/go-auto-wlan/assets"
+	"github.com/manuel-koch/go-auto-wlan/automation"
+	"github.com/manuel-koch/go-auto-wlan/config"
 	"github.com/manuel-koch/go-auto-wlan/service"
+	"github.com/manuel-koch/go-auto-wlan/utils"
 )
 
 const appName = "Auto WLAN"
-const maxWlanDevices = 3
-
-type wlanDeviceSettings struct {
-	device          string
-	enableOnLidOpen bool
-	toggleMenuItem  *systray.MenuItem
-}
 
 type App struct {
 	name        string
@@ -42,26 +42,46 @@ type App struct {
 	serviceCtx    context.Context
 	serviceCancel func()
 	service       *service.Service
-
-	wlanDeviceSettings      []wlanDeviceSettings
-	toggleWlanOnLidMenuItem *systray.MenuItem
-	quitMenuItem            *systray.MenuItem
+	automation    *automation.Automation
+
+	wlanDeviceSettingsMutex   sync.Mutex
+	wlanDeviceSettings        map[string]*wlanDeviceSettings
+	wlanDevicesMenuItem       *systray.MenuItem
+	toggleWlanOnLidMenuItem   *systray.MenuItem
+	keepOnInClamshellMenuItem *systray.MenuItem
+	onlyOnBatteryMenuItem     *systray.MenuItem
+	offOnLowBatteryMenuItem   *systray.MenuItem
+	wlanOffOnEthernetMenuItem *systray.MenuItem
+	trustNetworkMenuItem      *systray.MenuItem
+
+	wlanOffDelayMutex     sync.Mutex
+	wlanOffDelayRemaining map[string]time.Duration
+	wlanOffDelayMenuItem  *systray.MenuItem
+
+	bluetoothMenuItem            *systray.MenuItem
+	toggleBluetoothOnLidMenuItem *systray.MenuItem
+
+	quitMenuItem *systray.MenuItem
 }
 
-func NewApp(versionInfo, versionsSha1, buildInfo string) *App {
+func NewApp(versionInfo, versionsSha1, buildInfo string, backends service.Backends, cfg *config.Config, state *config.State, clock utils.Clock) *App {
 	logger.Info(fmt.Sprintf("%s, version v%s (%s), built %s", appName, versionInfo, versionsSha1, buildInfo))
 	serviceCtx, serviceCancel := context.WithCancel(context.Background())
-	return &App{
+	a := &App{
 		name:        appName,
 		versionInfo: versionInfo,
 		buildInfo:   buildInfo,
 
 		serviceCtx:    serviceCtx,
 		serviceCancel: serviceCancel,
-		service:       service.NewService(serviceCtx),
+		service:       service.NewService(serviceCtx, backends),
 
-		wlanDeviceSettings: make([]wlanDeviceSettings, maxWlanDevices),
+		wlanDeviceSettings: map[string]*wlanDeviceSettings{},
+
+		wlanOffDelayRemaining: map[string]time.Duration{},
 	}
+	a.automation = automation.NewAutomation(a.service, cfg, state, clock, a.updateWlanOffDelayMenuItem)
+	return a
 }
 
 func (a *App) Shutdown() {
@@ -73,73 +93,146 @@ func (a *App) Shutdown() {
 func (a *App) handleServiceEvents(subscription *service.EventSubscription) {
 	logger.Info("Starting to handle service events")
 	for event := range subscription.Updates() {
-		if lidEvent, ok := event.(service.LidStateChangedEvent); ok {
-			a.handleLidEvent(lidEvent)
-		} else if wlanEvent, ok := event.(service.WlanStateChangedEvent); ok {
+		if wlanEvent, ok := event.(service.WlanStateChangedEvent); ok {
 			a.handleWlanEvent(wlanEvent)
+		} else if addedEvent, ok := event.(service.WlanDeviceAddedEvent); ok {
+			logger.Info(fmt.Sprintf("App handling wlan device added %s", addedEvent.Device.String()))
+		} else if removedEvent, ok := event.(service.WlanDeviceRemovedEvent); ok {
+			logger.Info(fmt.Sprintf("App handling wlan device removed %s", removedEvent.Device.Name))
+		} else if changedEvent, ok := event.(service.WlanDeviceChangedEvent); ok {
+			logger.Debug(fmt.Sprintf("App handling wlan device changed %s", changedEvent.Device.String()))
+		} else if bluetoothEvent, ok := event.(service.BluetoothStateChangedEvent); ok {
+			a.handleBluetoothEvent(bluetoothEvent)
+		} else if powerEvent, ok := event.(service.PowerStateChangedEvent); ok {
+			logger.Info(fmt.Sprintf("App handling power event %s", powerEvent.PowerState.String()))
 		}
 	}
 	logger.Info("Stopped handling service events")
 }
 
-func (a *App) handleLidEvent(lidEvent service.LidStateChangedEvent) {
-	logger.Info(fmt.Sprintf("App handling lid event %s", service.LidStateToString(lidEvent.LidState)))
-	for i := range a.wlanDeviceSettings {
-		setting := &a.wlanDeviceSettings[i]
-		if len(setting.device) > 0 {
-			switch lidEvent.LidState {
-			case service.LidOpen:
-				{
-					if setting.enableOnLidOpen {
-						a.service.SetWlanState(setting.device, service.WlanPowerOn)
-						setting.enableOnLidOpen = false
-					}
-				}
-			case service.LidClosed:
-				{
-					if setting.toggleMenuItem.Checked() {
-						a.service.SetWlanState(setting.device, service.WlanPowerOff)
-						setting.enableOnLidOpen = true
-					}
-				}
-			}
+// updateWlanOffDelayMenuItem shows the remaining time until the next device gets switched off.
+func (a *App) updateWlanOffDelayMenuItem(device string, remaining time.Duration) {
+	a.wlanOffDelayMutex.Lock()
+	defer a.wlanOffDelayMutex.Unlock()
+	if remaining > 0 {
+		a.wlanOffDelayRemaining[device] = remaining
+	} else {
+		delete(a.wlanOffDelayRemaining, device)
+	}
+	if a.wlanOffDelayMenuItem == nil {
+		return
+	}
+	if len(a.wlanOffDelayRemaining) == 0 {
+		a.wlanOffDelayMenuItem.Hide()
+		return
+	}
+	next := time.Duration(0)
+	for _, deviceRemaining := range a.wlanOffDelayRemaining {
+		if next == 0 || deviceRemaining < next {
+			next = deviceRemaining
 		}
 	}
+	seconds := int((next + time.Second - 1) / time.Second)
+	a.wlanOffDelayMenuItem.SetTitle(fmt.Sprintf("WLAN off in %ds", seconds))
+	a.wlanOffDelayMenuItem.Show()
 }
 
-func (a *App) handleWlanEvent(wlanEvent service.WlanStateChangedEvent) {
-	logger.Info("App handling wlan event")
-	a.updateWlanSettings(wlanEvent.Devices)
+// changeDeviceConfig applies given change to the settings of named device and persists them.
+func (a *App) changeDeviceConfig(device string, change func(deviceConfig *config.DeviceConfig)) {
+	a.automation.ChangeConfig(func(cfg *config.Config) {
+		deviceConfig := cfg.Device(device)
+		change(&deviceConfig)
+		cfg.SetDevice(device, deviceConfig)
+	})
 }
 
-func (a *App) updateWlanSettings(devices []service.WlanDevice) {
-	for i := range a.wlanDeviceSettings {
-		if i < len(devices) {
-			a.updateWlanMenuItem(&a.wlanDeviceSettings[i], devices[i])
-		} else {
-			a.wlanDeviceSettings[i].toggleMenuItem.Hide()
+// saveConfig persists the current menu settings.
+func (a *App) saveConfig() {
+	a.automation.ChangeConfig(func(cfg *config.Config) {
+		cfg.ToggleWlanOnLid = a.toggleWlanOnLidMenuItem.Checked()
+		cfg.KeepOnInClamshell = a.keepOnInClamshellMenuItem.Checked()
+		cfg.OnlyOnBattery = a.onlyOnBatteryMenuItem.Checked()
+		cfg.OffOnLowBattery = a.offOnLowBatteryMenuItem.Checked()
+		cfg.WlanOffOnEthernet = a.wlanOffOnEthernetMenuItem.Checked()
+		cfg.ToggleBluetoothOnLid = a.toggleBluetoothOnLidMenuItem.Checked()
+	})
+}
+
+// currentNetworks returns the networks the WLAN devices are connected to.
+func (a *App) currentNetworks() []string {
+	networks := make([]string, 0)
+	for _, device := range a.service.GetWlanDevices() {
+		if len(device.Network) > 0 && !slices.Contains(networks, device.Network) {
+			networks = append(networks, device.Network)
 		}
 	}
-	a.updateIcon()
+	return networks
 }
 
-func (a *App) updateWlanMenuItem(setting *wlanDeviceSettings, device service.WlanDevice) {
-	setting.toggleMenuItem.Show()
+// toggleTrustCurrentNetwork trusts the current networks,
+// or distrusts them when they are trusted already.
+func (a *App) toggleTrustCurrentNetwork() {
+	networks := a.currentNetworks()
+	trusted := a.trustNetworkMenuItem.Checked()
+	a.automation.ChangeConfig(func(cfg *config.Config) {
+		for _, network := range networks {
+			if trusted {
+				logger.Info(fmt.Sprintf("Distrusting network %s", network))
+				cfg.TrustedNetworks = slices.DeleteFunc(cfg.TrustedNetworks, func(n string) bool { return n == network })
+			} else if !slices.Contains(cfg.TrustedNetworks, network) {
+				logger.Info(fmt.Sprintf("Trusting network %s", network))
+				cfg.TrustedNetworks = append(cfg.TrustedNetworks, network)
+			}
+		}
+	})
+	a.updateTrustNetworkMenuItem()
+}
 
-	var title string
-	if len(device.Network) > 0 {
-		title = fmt.Sprintf("WLAN %s (%s)", device.Name, device.Network)
-	} else {
-		title = fmt.Sprintf("WLAN %s", device.Name)
+func (a *App) updateTrustNetworkMenuItem() {
+	networks := a.currentNetworks()
+	if len(networks) == 0 {
+		a.trustNetworkMenuItem.SetTitle("Trust current Network")
+		a.trustNetworkMenuItem.Uncheck()
+		a.trustNetworkMenuItem.Disable()
+		return
 	}
-	setting.toggleMenuItem.SetTitle(title)
+	a.trustNetworkMenuItem.Enable()
+	a.trustNetworkMenuItem.SetTitle(fmt.Sprintf("Trust current Network (%s)", strings.Join(networks, ", ")))
+	trusted := true
+	for _, network := range networks {
+		trusted = trusted && a.automation.IsTrustedNetwork(network)
+	}
+	if trusted && !a.trustNetworkMenuItem.Checked() {
+		a.trustNetworkMenuItem.Check()
+	}
+	if !trusted && a.trustNetworkMenuItem.Checked() {
+		a.trustNetworkMenuItem.Uncheck()
+	}
+}
 
-	setting.device = device.Name
-	if device.State == service.WlanPowerOn && !setting.toggleMenuItem.Checked() {
-		setting.toggleMenuItem.Check()
+func (a *App) handleWlanEvent(wlanEvent service.WlanStateChangedEvent) {
+	logger.Info("App handling wlan event")
+	a.updateWlanSettings(wlanEvent.Devices)
+}
+
+func (a *App) handleBluetoothEvent(bluetoothEvent service.BluetoothStateChangedEvent) {
+	logger.Info("App handling bluetooth event")
+	a.updateBluetoothMenuItem(bluetoothEvent.BluetoothState)
+}
+
+func (a *App) updateBluetoothMenuItem(state service.BluetoothState) {
+	if state == service.BluetoothUnknown {
+		a.bluetoothMenuItem.Hide()
+		a.toggleBluetoothOnLidMenuItem.Hide()
+		return
 	}
-	if device.State == service.WlanPowerOff && setting.toggleMenuItem.Checked() {
-		setting.toggleMenuItem.Uncheck()
+	a.bluetoothMenuItem.Show()
+	a.toggleBluetoothOnLidMenuItem.Show()
+	if state == service.BluetoothPowerOn && !a.bluetoothMenuItem.Checked() {
+		a.bluetoothMenuItem.Check()
+	}
+	if state == service.BluetoothPowerOff && a.bluetoothMenuItem.Checked() {
+		a.bluetoothMenuItem.Uncheck()
 	}
 }
 
@@ -150,14 +243,31 @@ func (a *App) Run() {
 func (a *App) onSystrayReady() {
 	logger.Debug("App configure systray")
 
+	cfg := a.automation.Config()
 	systray.SetTooltip(fmt.Sprintf("Version v%s, built %s", a.versionInfo, a.buildInfo))
 
-	for i := 0; i < maxWlanDevices; i++ {
-		a.wlanDeviceSettings[i].toggleMenuItem = systray.AddMenuItemCheckbox(fmt.Sprintf("WLAN %d", i), "Toggle WLAN", false)
-		a.wlanDeviceSettings[i].toggleMenuItem.Hide()
-	}
+	a.wlanDevicesMenuItem = systray.AddMenuItem("WLAN Devices", "WLAN devices")
+	a.wlanDevicesMenuItem.Hide()
 
-	a.toggleWlanOnLidMenuItem = systray.AddMenuItemCheckbox("Toggle WLAN on Lid", "Toggle WLAN when lid closes / opens", true)
+	a.wlanOffDelayMenuItem = systray.AddMenuItem("WLAN off in", "WLAN will be switched off, open lid to cancel")
+	a.wlanOffDelayMenuItem.Disable()
+	a.wlanOffDelayMenuItem.Hide()
+
+	a.toggleWlanOnLidMenuItem = systray.AddMenuItemCheckbox("Toggle WLAN on Lid", "Toggle WLAN when lid closes / opens", cfg.ToggleWlanOnLid)
+	a.keepOnInClamshellMenuItem = systray.AddMenuItemCheckbox("Keep on in Clamshell Mode", "Don't switch off when lid closes while an external display is connected", cfg.KeepOnInClamshell)
+	a.onlyOnBatteryMenuItem = systray.AddMenuItemCheckbox("Only on Battery", "Only switch off on lid close when running on battery", cfg.OnlyOnBattery)
+	a.offOnLowBatteryMenuItem = systray.AddMenuItemCheckbox(fmt.Sprintf("Always below %d%% Battery", cfg.LowBatteryPercentage),
+		fmt.Sprintf("Always switch off on lid close when battery is below %d%%", cfg.LowBatteryPercentage), cfg.OffOnLowBattery)
+	a.wlanOffOnEthernetMenuItem = systray.AddMenuItemCheckbox("WLAN off on Ethernet", "Switch WLAN off while wired network is connected", cfg.WlanOffOnEthernet)
+	a.trustNetworkMenuItem = systray.AddMenuItemCheckbox("Trust current Network", "Keep WLAN on when lid closes while connected to this network", false)
+	a.trustNetworkMenuItem.Disable()
+
+	systray.AddSeparator()
+
+	a.bluetoothMenuItem = systray.AddMenuItemCheckbox("Bluetooth", "Toggle Bluetooth", false)
+	a.bluetoothMenuItem.Hide()
+	a.toggleBluetoothOnLidMenuItem = systray.AddMenuItemCheckbox("Toggle Bluetooth on Lid", "Toggle Bluetooth when lid closes / opens", cfg.ToggleBluetoothOnLid)
+	a.toggleBluetoothOnLidMenuItem.Hide()
 
 	systray.AddSeparator()
 
@@ -165,25 +275,6 @@ func (a *App) onSystrayReady() {
 
 	done := false
 
-	for i := 0; i < maxWlanDevices; i++ {
-		go func(setting *wlanDeviceSettings) {
-			for !done {
-				select {
-				case <-setting.toggleMenuItem.ClickedCh:
-					{
-						if setting.toggleMenuItem.Checked() {
-							a.service.SetWlanState(setting.device, service.WlanPowerOff)
-							setting.toggleMenuItem.Uncheck()
-						} else {
-							a.service.SetWlanState(setting.device, service.WlanPowerOn)
-							setting.toggleMenuItem.Check()
-						}
-					}
-				}
-			}
-		}(&a.wlanDeviceSettings[i])
-	}
-
 	go func() {
 		for !done {
 			select {
@@ -194,6 +285,67 @@ func (a *App) onSystrayReady() {
 					} else {
 						a.toggleWlanOnLidMenuItem.Check()
 					}
+					a.saveConfig()
+				}
+			case <-a.keepOnInClamshellMenuItem.ClickedCh:
+				{
+					if a.keepOnInClamshellMenuItem.Checked() {
+						a.keepOnInClamshellMenuItem.Uncheck()
+					} else {
+						a.keepOnInClamshellMenuItem.Check()
+					}
+					a.saveConfig()
+				}
+			case <-a.onlyOnBatteryMenuItem.ClickedCh:
+				{
+					if a.onlyOnBatteryMenuItem.Checked() {
+						a.onlyOnBatteryMenuItem.Uncheck()
+					} else {
+						a.onlyOnBatteryMenuItem.Check()
+					}
+					a.saveConfig()
+				}
+			case <-a.offOnLowBatteryMenuItem.ClickedCh:
+				{
+					if a.offOnLowBatteryMenuItem.Checked() {
+						a.offOnLowBatteryMenuItem.Uncheck()
+					} else {
+						a.offOnLowBatteryMenuItem.Check()
+					}
+					a.saveConfig()
+				}
+			case <-a.wlanOffOnEthernetMenuItem.ClickedCh:
+				{
+					if a.wlanOffOnEthernetMenuItem.Checked() {
+						a.wlanOffOnEthernetMenuItem.Uncheck()
+					} else {
+						a.wlanOffOnEthernetMenuItem.Check()
+					}
+					a.saveConfig()
+					a.automation.ApplyEthernetPolicy()
+				}
+			case <-a.trustNetworkMenuItem.ClickedCh:
+				{
+					a.toggleTrustCurrentNetwork()
+				}
+			case <-a.bluetoothMenuItem.ClickedCh:
+				{
+					if a.bluetoothMenuItem.Checked() {
+						a.service.SetBluetoothState(service.BluetoothPowerOff)
+						a.bluetoothMenuItem.Uncheck()
+					} else {
+						a.service.SetBluetoothState(service.BluetoothPowerOn)
+						a.bluetoothMenuItem.Check()
+					}
+				}
+			case <-a.toggleBluetoothOnLidMenuItem.ClickedCh:
+				{
+					if a.toggleBluetoothOnLidMenuItem.Checked() {
+						a.toggleBluetoothOnLidMenuItem.Uncheck()
+					} else {
+						a.toggleBluetoothOnLidMenuItem.Check()
+					}
+					a.saveConfig()
 				}
 			case <-a.quitMenuItem.ClickedCh:
 				{
@@ -206,15 +358,18 @@ func (a *App) onSystrayReady() {
 	}()
 
 	a.updateWlanSettings(a.service.GetWlanDevices())
+	a.updateBluetoothMenuItem(a.service.GetBluetoothState())
 
 	subscription := a.service.Subscripe()
 	go a.handleServiceEvents(subscription)
 
+	a.automation.Start(a.serviceCtx)
+
 	logger.Debug("App configure systray done")
 }
 
 func (a *App) anyWlanOn() bool {
-	for _, setting := range a.wlanDeviceSettings {
+	for _, setting := range a.wlanDevices() {
 		if setting.toggleMenuItem.Checked() {
 			return true
 		}
@@ -0,0 +1,307 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package app
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"fyne.io/systray"
+	"github.com/manuel-koch/go-auto-wlan/config"
+	"github.com/manuel-koch/go-auto-wlan/service"
+)
+
+// deviceDelayOptions are the lid close delays selectable per device,
+// a negative delay uses the global lid close delay.
+var deviceDelayOptions = []time.Duration{-1, 0, 10 * time.Second, 30 * time.Second, time.Minute, 5 * time.Minute}
+
+type wlanDeviceSettings struct {
+	device string
+	// done stops handling the menu items once the device is removed
+	done chan interface{}
+
+	toggleMenuItem           *systray.MenuItem
+	powerMenuItem            *systray.MenuItem
+	detailsMenuItem          *systray.MenuItem
+	stateMenuItem            *systray.MenuItem
+	networkMenuItem          *systray.MenuItem
+	signalMenuItem           *systray.MenuItem
+	automationMenuItem       *systray.MenuItem
+	toggleOnLidMenuItem      *systray.MenuItem
+	restoreOnLidOpenMenuItem *systray.MenuItem
+	delayMenuItem            *systray.MenuItem
+	delayOptionMenuItems     []*systray.MenuItem
+}
+
+// wlanDevices returns the settings of all WLAN devices ordered by device name.
+func (a *App) wlanDevices() []*wlanDeviceSettings {
+	a.wlanDeviceSettingsMutex.Lock()
+	defer a.wlanDeviceSettingsMutex.Unlock()
+	settings := make([]*wlanDeviceSettings, 0, len(a.wlanDeviceSettings))
+	for _, setting := range a.wlanDeviceSettings {
+		settings = append(settings, setting)
+	}
+	slices.SortFunc(settings, func(a, b *wlanDeviceSettings) int {
+		return strings.Compare(a.device, b.device)
+	})
+	return settings
+}
+
+// wlanDevice returns the settings of named WLAN device, nil for unknown devices.
+func (a *App) wlanDevice(name string) *wlanDeviceSettings {
+	a.wlanDeviceSettingsMutex.Lock()
+	defer a.wlanDeviceSettingsMutex.Unlock()
+	return a.wlanDeviceSettings[name]
+}
+
+// updateWlanSettings reconciles the device menu entries by device name,
+// adding entries for new devices and removing entries of devices that are gone.
+func (a *App) updateWlanSettings(devices []service.WlanDevice) {
+	a.wlanDeviceSettingsMutex.Lock()
+	names := make([]string, 0, len(devices))
+	for _, device := range devices {
+		names = append(names, device.Name)
+		setting, ok := a.wlanDeviceSettings[device.Name]
+		if !ok {
+			setting = a.addWlanDevice(device.Name)
+			a.wlanDeviceSettings[device.Name] = setting
+		}
+		a.updateWlanMenuItem(setting, device)
+	}
+	for name, setting := range a.wlanDeviceSettings {
+		if !slices.Contains(names, name) {
+			a.removeWlanDevice(setting)
+			delete(a.wlanDeviceSettings, name)
+		}
+	}
+	if len(a.wlanDeviceSettings) > 0 {
+		a.wlanDevicesMenuItem.Show()
+	} else {
+		a.wlanDevicesMenuItem.Hide()
+	}
+	a.wlanDeviceSettingsMutex.Unlock()
+
+	a.updateTrustNetworkMenuItem()
+	a.updateIcon()
+}
+
+// addWlanDevice adds the menu entry of named device with its submenu.
+func (a *App) addWlanDevice(name string) *wlanDeviceSettings {
+	logger.Info(fmt.Sprintf("Adding menu entry for WLAN %s", name))
+	setting := &wlanDeviceSettings{
+		device: name,
+		done:   make(chan interface{}),
+	}
+
+	setting.toggleMenuItem = a.wlanDevicesMenuItem.AddSubMenuItemCheckbox(name, "WLAN device", false)
+	setting.powerMenuItem = setting.toggleMenuItem.AddSubMenuItemCheckbox("Power", "Toggle WLAN power", false)
+
+	setting.detailsMenuItem = setting.toggleMenuItem.AddSubMenuItem("Details", "WLAN device details")
+	setting.stateMenuItem = setting.detailsMenuItem.AddSubMenuItem("State", "")
+	setting.stateMenuItem.Disable()
+	setting.networkMenuItem = setting.detailsMenuItem.AddSubMenuItem("Network", "")
+	setting.networkMenuItem.Disable()
+	setting.signalMenuItem = setting.detailsMenuItem.AddSubMenuItem("Signal", "")
+	setting.signalMenuItem.Disable()
+
+	setting.automationMenuItem = setting.toggleMenuItem.AddSubMenuItem("Automation", "Lid automation of this device")
+	setting.toggleOnLidMenuItem = setting.automationMenuItem.AddSubMenuItemCheckbox("Switch off on Lid Close",
+		"Switch this device off when lid closes", true)
+	setting.restoreOnLidOpenMenuItem = setting.automationMenuItem.AddSubMenuItemCheckbox("Restore on Lid Open",
+		"Switch this device on again when lid opens", true)
+	setting.delayMenuItem = setting.automationMenuItem.AddSubMenuItem("Delay on Lid Close", "Delay switching this device off when lid closes")
+	setting.delayOptionMenuItems = make([]*systray.MenuItem, len(deviceDelayOptions))
+	for j, delay := range deviceDelayOptions {
+		setting.delayOptionMenuItems[j] = setting.delayMenuItem.AddSubMenuItemCheckbox(delayOptionTitle(delay), "", false)
+	}
+
+	go a.handleWlanMenuItems(setting)
+	return setting
+}
+
+// removeWlanDevice removes the menu entry of the device.
+func (a *App) removeWlanDevice(setting *wlanDeviceSettings) {
+	logger.Info(fmt.Sprintf("Removing menu entry for WLAN %s", setting.device))
+	close(setting.done)
+	// remove the submenu first, removing an item only drops the item itself
+	for _, menuItem := range setting.delayOptionMenuItems {
+		menuItem.Remove()
+	}
+	for _, menuItem := range []*systray.MenuItem{
+		setting.delayMenuItem, setting.toggleOnLidMenuItem, setting.restoreOnLidOpenMenuItem, setting.automationMenuItem,
+		setting.signalMenuItem, setting.networkMenuItem, setting.stateMenuItem, setting.detailsMenuItem,
+		setting.powerMenuItem, setting.toggleMenuItem,
+	} {
+		menuItem.Remove()
+	}
+}
+
+func (a *App) updateWlanMenuItem(setting *wlanDeviceSettings, device service.WlanDevice) {
+	var title string
+	if device.State == service.WlanHardBlocked {
+		title = fmt.Sprintf("%s (hard blocked)", device.Name)
+	} else if len(device.Network) > 0 {
+		title = fmt.Sprintf("%s (%s)", device.Name, device.Network)
+	} else {
+		title = device.Name
+	}
+	setting.toggleMenuItem.SetTitle(title)
+
+	setCheckedMenuItem(setting.toggleMenuItem, device.State == service.WlanPowerOn)
+
+	// a radio blocked by hardware switch can't be toggled by us
+	if device.State == service.WlanHardBlocked {
+		setting.powerMenuItem.Disable()
+	} else {
+		setting.powerMenuItem.Enable()
+	}
+	setCheckedMenuItem(setting.powerMenuItem, device.State == service.WlanPowerOn)
+
+	setting.stateMenuItem.SetTitle(fmt.Sprintf("State: %s", service.WlanStateToString(device.State)))
+	if len(device.Network) > 0 {
+		setting.networkMenuItem.SetTitle(fmt.Sprintf("Network: %s", device.Network))
+	} else {
+		setting.networkMenuItem.SetTitle("Network: none")
+	}
+	if device.Signal != 0 {
+		setting.signalMenuItem.SetTitle(fmt.Sprintf("Signal: %d dBm", device.Signal))
+		setting.signalMenuItem.Show()
+	} else {
+		setting.signalMenuItem.Hide()
+	}
+
+	deviceConfig := a.automation.DeviceConfig(device.Name)
+	setCheckedMenuItem(setting.toggleOnLidMenuItem, deviceConfig.ToggleOnLid)
+	setCheckedMenuItem(setting.restoreOnLidOpenMenuItem, deviceConfig.RestoreOnLidOpen)
+	for i, delay := range deviceDelayOptions {
+		selected := (delay < 0 && deviceConfig.LidCloseDelay == nil) ||
+			(deviceConfig.LidCloseDelay != nil && *deviceConfig.LidCloseDelay == delay)
+		setCheckedMenuItem(setting.delayOptionMenuItems[i], selected)
+		if selected {
+			setting.delayMenuItem.SetTitle(fmt.Sprintf("Delay on Lid Close: %s", delayOptionTitle(delay)))
+		}
+	}
+}
+
+func setCheckedMenuItem(menuItem *systray.MenuItem, checked bool) {
+	if checked && !menuItem.Checked() {
+		menuItem.Check()
+	}
+	if !checked && menuItem.Checked() {
+		menuItem.Uncheck()
+	}
+}
+
+func delayOptionTitle(delay time.Duration) string {
+	switch {
+	case delay < 0:
+		return "global"
+	case delay == 0:
+		return "none"
+	default:
+		return delay.String()
+	}
+}
+
+// toggleWlanPower switches the device on or off, depending on its menu entry.
+func (a *App) toggleWlanPower(setting *wlanDeviceSettings) {
+	if setting.powerMenuItem.Disabled() {
+		return
+	}
+	if setting.toggleMenuItem.Checked() {
+		a.automation.SetWlanState(setting.device, service.WlanPowerOff)
+		setting.toggleMenuItem.Uncheck()
+		setting.powerMenuItem.Uncheck()
+	} else {
+		a.automation.SetWlanState(setting.device, service.WlanPowerOn)
+		setting.toggleMenuItem.Check()
+		setting.powerMenuItem.Check()
+	}
+}
+
+// handleWlanMenuItems handles clicks on the menu entry of a device and its submenu,
+// until the device is removed.
+func (a *App) handleWlanMenuItems(setting *wlanDeviceSettings) {
+	delayOptionClicked := make(chan int)
+	for i, menuItem := range setting.delayOptionMenuItems {
+		go func(i int, menuItem *systray.MenuItem) {
+			for {
+				select {
+				case <-setting.done:
+					return
+				case _, ok := <-menuItem.ClickedCh:
+					if !ok {
+						return
+					}
+					select {
+					case delayOptionClicked <- i:
+					case <-setting.done:
+						return
+					}
+				}
+			}
+		}(i, menuItem)
+	}
+
+	for {
+		// removed menu items close their click channel
+		select {
+		case <-setting.done:
+			return
+		case _, ok := <-setting.toggleMenuItem.ClickedCh:
+			if !ok {
+				return
+			}
+			a.toggleWlanPower(setting)
+		case _, ok := <-setting.powerMenuItem.ClickedCh:
+			if !ok {
+				return
+			}
+			a.toggleWlanPower(setting)
+		case _, ok := <-setting.toggleOnLidMenuItem.ClickedCh:
+			if !ok {
+				return
+			}
+			a.changeDeviceConfig(setting.device, func(deviceConfig *config.DeviceConfig) {
+				deviceConfig.ToggleOnLid = !deviceConfig.ToggleOnLid
+			})
+			setCheckedMenuItem(setting.toggleOnLidMenuItem, a.automation.DeviceConfig(setting.device).ToggleOnLid)
+		case _, ok := <-setting.restoreOnLidOpenMenuItem.ClickedCh:
+			if !ok {
+				return
+			}
+			a.changeDeviceConfig(setting.device, func(deviceConfig *config.DeviceConfig) {
+				deviceConfig.RestoreOnLidOpen = !deviceConfig.RestoreOnLidOpen
+			})
+			setCheckedMenuItem(setting.restoreOnLidOpenMenuItem, a.automation.DeviceConfig(setting.device).RestoreOnLidOpen)
+		case i := <-delayOptionClicked:
+			a.changeDeviceConfig(setting.device, func(deviceConfig *config.DeviceConfig) {
+				if delay := deviceDelayOptions[i]; delay < 0 {
+					deviceConfig.LidCloseDelay = nil
+				} else {
+					deviceConfig.LidCloseDelay = &delay
+				}
+			})
+			for j, menuItem := range setting.delayOptionMenuItems {
+				setCheckedMenuItem(menuItem, i == j)
+			}
+			setting.delayMenuItem.SetTitle(fmt.Sprintf("Delay on Lid Close: %s", delayOptionTitle(deviceDelayOptions[i])))
+		}
+	}
+}
@@ -0,0 +1,493 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package automation
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/config"
+	"github.com/manuel-koch/go-auto-wlan/rules"
+	"github.com/manuel-koch/go-auto-wlan/service"
+	"github.com/manuel-koch/go-auto-wlan/utils"
+)
+
+// Controller is the part of the service the automation queries state from, acts on and subscribes to.
+type Controller interface {
+	rules.Controller
+	GetBluetoothState() service.BluetoothState
+	Subscripe() *service.EventSubscription
+}
+
+// Automation switches WLAN and Bluetooth on lid, ethernet and power changes
+// as configured, independent of any user interface.
+type Automation struct {
+	ctx     context.Context
+	service Controller
+	state   *config.State
+	clock   utils.Clock
+
+	configMutex sync.Mutex
+	config      *config.Config
+	rulesCancel func()
+
+	devicesMutex sync.Mutex
+	devices      map[string]*wlanDevice
+	// rememberedDevices keeps the lid and ethernet state of removed devices,
+	// guarded by devicesMutex
+	rememberedDevices map[string]rememberedDevice
+
+	// enableBluetoothOnLidOpen is set when the lid close switched Bluetooth off
+	enableBluetoothOnLidOpen atomic.Bool
+
+	// onOffDelay gets the remaining time until named device gets switched off,
+	// zero once it got switched off or the delay got cancelled.
+	onOffDelay func(device string, remaining time.Duration)
+}
+
+// wlanDevice is the automation state of a WLAN device.
+type wlanDevice struct {
+	name                 string
+	state                service.WlanState
+	network              string
+	enableOnLidOpen      bool
+	enableOnEthernetDown bool
+	offDelay             *delayedAction
+}
+
+// rememberedDevice is the automation state of a removed device,
+// restored when the device comes back, e.g. a USB dongle that got plugged in again.
+type rememberedDevice struct {
+	enableOnLidOpen      bool
+	enableOnEthernetDown bool
+}
+
+// NewAutomation returns the automation of given service,
+// onOffDelay is optional to report the remaining time of lid close delays.
+func NewAutomation(svc Controller, cfg *config.Config, state *config.State, clock utils.Clock,
+	onOffDelay func(device string, remaining time.Duration)) *Automation {
+	if onOffDelay == nil {
+		onOffDelay = func(device string, remaining time.Duration) {}
+	}
+	return &Automation{
+		service: svc,
+		state:   state,
+		clock:   clock,
+		config:  cfg,
+
+		devices:           map[string]*wlanDevice{},
+		rememberedDevices: map[string]rememberedDevice{},
+
+		onOffDelay: onOffDelay,
+	}
+}
+
+// Start restores devices switched off in a previous run and handles service events
+// until the context is done.
+func (a *Automation) Start(ctx context.Context) {
+	logger.Info("Starting automation")
+	a.ctx = ctx
+	a.updateDevices(a.service.GetWlanDevices())
+	a.logMissingSwitchedOffDevices()
+	a.ApplyEthernetPolicy()
+
+	subscription := a.service.Subscripe()
+	go a.handleServiceEvents(subscription)
+
+	a.configMutex.Lock()
+	a.startRules(a.config.Rules)
+	a.configMutex.Unlock()
+}
+
+// startRules runs the rules engine for given rules,
+// caller must hold the config mutex.
+func (a *Automation) startRules(rulesToRun []rules.Rule) {
+	if a.rulesCancel != nil {
+		a.rulesCancel()
+		a.rulesCancel = nil
+	}
+	if len(rulesToRun) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.rulesCancel = cancel
+	subscription := a.service.Subscripe()
+	go func() {
+		rules.NewEngine(rulesToRun, a.service, a.clock).Run(ctx, subscription.Updates())
+		// keep consuming events until unsubscribed, the service blocks on publishing them
+		go subscription.Unsubscribe()
+		for range subscription.Updates() {
+		}
+	}()
+}
+
+func (a *Automation) handleServiceEvents(subscription *service.EventSubscription) {
+	logger.Info("Starting to handle service events")
+	for event := range subscription.Updates() {
+		if lidEvent, ok := event.(service.LidStateChangedEvent); ok {
+			a.handleLidEvent(lidEvent)
+		} else if wlanEvent, ok := event.(service.WlanStateChangedEvent); ok {
+			a.updateDevices(wlanEvent.Devices)
+		} else if ethernetEvent, ok := event.(service.EthernetStateChangedEvent); ok {
+			logger.Info("Automation handling ethernet event")
+			a.applyEthernetPolicy(ethernetEvent.Devices)
+		}
+	}
+	logger.Info("Stopped handling service events")
+}
+
+// Config returns a copy of the current config.
+func (a *Automation) Config() config.Config {
+	a.configMutex.Lock()
+	defer a.configMutex.Unlock()
+	return *a.config
+}
+
+// ChangeConfig applies given change to the config and persists it.
+func (a *Automation) ChangeConfig(change func(cfg *config.Config)) {
+	a.configMutex.Lock()
+	defer a.configMutex.Unlock()
+	change(a.config)
+	if err := a.config.Save(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save config: %v", err))
+	}
+}
+
+// SetConfig replaces the config, e.g. after it got reloaded, and restarts the rules.
+// Poll intervals and log options only apply on next start.
+func (a *Automation) SetConfig(cfg *config.Config) {
+	a.configMutex.Lock()
+	a.config = cfg
+	if a.ctx != nil {
+		a.startRules(cfg.Rules)
+	}
+	a.configMutex.Unlock()
+	a.ApplyEthernetPolicy()
+}
+
+// DeviceConfig returns the settings of named device.
+func (a *Automation) DeviceConfig(device string) config.DeviceConfig {
+	a.configMutex.Lock()
+	defer a.configMutex.Unlock()
+	return a.config.Device(device)
+}
+
+func (a *Automation) IsTrustedNetwork(network string) bool {
+	a.configMutex.Lock()
+	defer a.configMutex.Unlock()
+	return len(network) > 0 && slices.Contains(a.config.TrustedNetworks, network)
+}
+
+// SetWlanState switches given device on behalf of the user,
+// devices switched on that way are no longer restored by automation.
+func (a *Automation) SetWlanState(device string, state service.WlanState) {
+	a.service.SetWlanState(device, state)
+	if state == service.WlanPowerOn {
+		a.state.RemoveSwitchedOff(device)
+	}
+	a.updateDevice(device, func(d *wlanDevice) {
+		d.state = state
+	})
+}
+
+// wlanDevices returns a snapshot of the automation state of all WLAN devices ordered by device name,
+// use updateDevice to change it.
+func (a *Automation) wlanDevices() []wlanDevice {
+	a.devicesMutex.Lock()
+	defer a.devicesMutex.Unlock()
+	devices := make([]wlanDevice, 0, len(a.devices))
+	for _, device := range a.devices {
+		devices = append(devices, *device)
+	}
+	slices.SortFunc(devices, func(a, b wlanDevice) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return devices
+}
+
+// updateDevice changes the automation state of named device, unless it is gone.
+func (a *Automation) updateDevice(name string, change func(d *wlanDevice)) {
+	a.devicesMutex.Lock()
+	defer a.devicesMutex.Unlock()
+	if d, ok := a.devices[name]; ok {
+		change(d)
+	}
+}
+
+// updateDevices reconciles the automation state of devices by device name,
+// remembering the state of devices that are gone until they come back.
+func (a *Automation) updateDevices(devices []service.WlanDevice) {
+	a.devicesMutex.Lock()
+	names := make([]string, 0, len(devices))
+	added := make([]service.WlanDevice, 0)
+	for _, device := range devices {
+		names = append(names, device.Name)
+		d, ok := a.devices[device.Name]
+		if !ok {
+			d = a.addDevice(device.Name)
+			a.devices[device.Name] = d
+			added = append(added, device)
+		}
+		d.state = device.State
+		d.network = device.Network
+	}
+	for name, d := range a.devices {
+		if !slices.Contains(names, name) {
+			a.removeDevice(d)
+			delete(a.devices, name)
+		}
+	}
+	a.devicesMutex.Unlock()
+
+	switchedOff := a.state.SwitchedOffDevices()
+	for _, device := range added {
+		if slices.Contains(switchedOff, device.Name) {
+			a.restoreSwitchedOffDevice(device)
+		}
+	}
+}
+
+// addDevice returns the automation state of a new device,
+// caller must hold the devices mutex.
+func (a *Automation) addDevice(name string) *wlanDevice {
+	d := &wlanDevice{name: name}
+	if remembered, ok := a.rememberedDevices[name]; ok {
+		logger.Info(fmt.Sprintf("Restoring automation state of WLAN %s", name))
+		d.enableOnLidOpen = remembered.enableOnLidOpen
+		d.enableOnEthernetDown = remembered.enableOnEthernetDown
+		delete(a.rememberedDevices, name)
+	}
+	d.offDelay = newDelayedAction(a.clock, func(remaining time.Duration) {
+		a.onOffDelay(name, remaining)
+	})
+	return d
+}
+
+// removeDevice drops pending actions of a removed device and remembers its state,
+// caller must hold the devices mutex.
+func (a *Automation) removeDevice(d *wlanDevice) {
+	d.offDelay.Cancel()
+	if d.enableOnLidOpen || d.enableOnEthernetDown {
+		a.rememberedDevices[d.name] = rememberedDevice{
+			enableOnLidOpen:      d.enableOnLidOpen,
+			enableOnEthernetDown: d.enableOnEthernetDown,
+		}
+	}
+}
+
+func (a *Automation) handleLidEvent(lidEvent service.LidStateChangedEvent) {
+	if lidEvent.Replayed {
+		logger.Info(fmt.Sprintf("Automation handling replayed lid event %s", service.LidStateToString(lidEvent.LidState)))
+	} else {
+		logger.Info(fmt.Sprintf("Automation handling lid event %s", service.LidStateToString(lidEvent.LidState)))
+	}
+
+	cfg := a.Config()
+	lidState := lidEvent.LidState
+	if lidState == service.LidClosed && lidEvent.Clamshell && cfg.KeepOnInClamshell {
+		// an external display keeps the laptop in use, behave like the lid is open
+		logger.Info("Lid closed in clamshell mode, keeping radios on")
+		lidState = service.LidOpen
+	}
+	keptOffByEthernet := lidState == service.LidOpen && a.wiredNetworkKeepsWlanOff()
+
+	for _, device := range a.wlanDevices() {
+		deviceConfig := a.DeviceConfig(device.name)
+		switch lidState {
+		case service.LidOpen:
+			{
+				// devices are only switched off after the grace period,
+				// reopening the lid within it keeps them on
+				enableOnEthernetDown := false
+				if device.offDelay.Cancel() {
+					logger.Info(fmt.Sprintf("Lid opened within grace period, keeping WLAN %s on", device.name))
+				} else if device.enableOnLidOpen {
+					if !deviceConfig.RestoreOnLidOpen {
+						a.state.RemoveSwitchedOff(device.name)
+					} else if keptOffByEthernet {
+						logger.Info(fmt.Sprintf("Wired network is up, restoring WLAN %s when it is down", device.name))
+						enableOnEthernetDown = true
+					} else {
+						a.setWlanStateByAutomation(device.name, service.WlanPowerOn)
+					}
+				}
+				a.updateDevice(device.name, func(d *wlanDevice) {
+					d.enableOnLidOpen = false
+					if enableOnEthernetDown {
+						d.enableOnEthernetDown = true
+					}
+				})
+			}
+		case service.LidClosed:
+			{
+				if a.IsTrustedNetwork(device.network) {
+					logger.Info(fmt.Sprintf("WLAN %s connected to trusted network %s, keeping it on", device.name, device.network))
+				} else if a.switchOffOnLidClose(cfg.ToggleWlanOnLid) && deviceConfig.ToggleOnLid &&
+					device.state == service.WlanPowerOn {
+					a.switchWlanOff(device)
+					a.updateDevice(device.name, func(d *wlanDevice) {
+						d.enableOnLidOpen = true
+					})
+				}
+			}
+		}
+	}
+
+	switch lidState {
+	case service.LidOpen:
+		if a.enableBluetoothOnLidOpen.Swap(false) {
+			a.service.SetBluetoothState(service.BluetoothPowerOn)
+		}
+	case service.LidClosed:
+		if a.switchOffOnLidClose(cfg.ToggleBluetoothOnLid) && a.service.GetBluetoothState() == service.BluetoothPowerOn {
+			a.service.SetBluetoothState(service.BluetoothPowerOff)
+			a.enableBluetoothOnLidOpen.Store(true)
+		}
+	}
+}
+
+// setWlanStateByAutomation switches given device, remembering devices switched off
+// so they can be restored after a crash or quit while the lid was closed.
+func (a *Automation) setWlanStateByAutomation(device string, state service.WlanState) {
+	a.service.SetWlanState(device, state)
+	if state == service.WlanPowerOff {
+		a.state.AddSwitchedOff(device)
+	} else {
+		a.state.RemoveSwitchedOff(device)
+	}
+	a.updateDevice(device, func(d *wlanDevice) {
+		d.state = state
+	})
+}
+
+// restoreSwitchedOffDevice restores a device switched off by automation in a previous run
+// or before it was removed, unless the lid or a wired network keep it off for now.
+func (a *Automation) restoreSwitchedOffDevice(device service.WlanDevice) {
+	name := device.Name
+	if device.State != service.WlanPowerOff || !a.DeviceConfig(name).RestoreOnLidOpen {
+		a.state.RemoveSwitchedOff(name)
+		return
+	}
+	if a.wiredNetworkKeepsWlanOff() {
+		logger.Info(fmt.Sprintf("WLAN %s switched off by automation, restoring it when wired network is down", name))
+		a.updateDevice(name, func(d *wlanDevice) {
+			d.enableOnEthernetDown = true
+		})
+		return
+	}
+	if a.service.GetLidState() == service.LidClosed {
+		logger.Info(fmt.Sprintf("WLAN %s switched off by automation, restoring it on lid open", name))
+		a.updateDevice(name, func(d *wlanDevice) {
+			d.enableOnLidOpen = true
+		})
+		return
+	}
+	logger.Info(fmt.Sprintf("Restoring WLAN %s switched off by automation", name))
+	a.setWlanStateByAutomation(name, service.WlanPowerOn)
+}
+
+// logMissingSwitchedOffDevices logs the devices switched off by automation that are gone,
+// they get restored when they appear again.
+func (a *Automation) logMissingSwitchedOffDevices() {
+	a.devicesMutex.Lock()
+	defer a.devicesMutex.Unlock()
+	for _, name := range a.state.SwitchedOffDevices() {
+		if _, ok := a.devices[name]; !ok {
+			logger.Info(fmt.Sprintf("WLAN %s switched off by automation is missing, restoring it when it appears", name))
+		}
+	}
+}
+
+// wiredNetworkKeepsWlanOff returns whether the ethernet policy keeps WLAN off,
+// as a wired link is up.
+func (a *Automation) wiredNetworkKeepsWlanOff() bool {
+	return a.Config().WlanOffOnEthernet && service.AnyEthernetLinkUp(a.service.GetEthernetDevices())
+}
+
+// switchWlanOff switches the device off, after its lid close delay if configured.
+func (a *Automation) switchWlanOff(device wlanDevice) {
+	name := device.name
+	a.configMutex.Lock()
+	lidCloseDelay := a.config.DeviceLidCloseDelay(name)
+	a.configMutex.Unlock()
+	if lidCloseDelay <= 0 {
+		a.setWlanStateByAutomation(name, service.WlanPowerOff)
+		return
+	}
+	logger.Info(fmt.Sprintf("Switching WLAN %s off in %s", name, lidCloseDelay))
+	device.offDelay.Start(lidCloseDelay, func() {
+		a.setWlanStateByAutomation(name, service.WlanPowerOff)
+	})
+}
+
+// switchOffOnLidClose returns whether a radio with given lid toggle
+// shall be switched off on lid close, depending on the power source.
+func (a *Automation) switchOffOnLidClose(toggleOnLid bool) bool {
+	cfg := a.Config()
+	powerState := a.service.GetPowerState()
+	if cfg.OffOnLowBattery && powerState.IsBatteryBelow(cfg.LowBatteryPercentage) {
+		return true
+	}
+	if !toggleOnLid {
+		return false
+	}
+	if cfg.OnlyOnBattery && powerState.Source != service.PowerSourceBattery {
+		logger.Info(fmt.Sprintf("Not on battery power, keeping radios on (%s)", powerState.String()))
+		return false
+	}
+	return true
+}
+
+// ApplyEthernetPolicy applies the ethernet policy to the current wired links,
+// e.g. after it got enabled.
+func (a *Automation) ApplyEthernetPolicy() {
+	a.applyEthernetPolicy(a.service.GetEthernetDevices())
+}
+
+// applyEthernetPolicy switches WLAN off while any wired link is up
+// and restores it when all wired links are down again.
+func (a *Automation) applyEthernetPolicy(devices []service.EthernetDevice) {
+	wiredUp := service.AnyEthernetLinkUp(devices)
+	wlanOffOnEthernet := a.Config().WlanOffOnEthernet
+	for _, device := range a.wlanDevices() {
+		if wiredUp {
+			if wlanOffOnEthernet && device.state == service.WlanPowerOn {
+				a.setWlanStateByAutomation(device.name, service.WlanPowerOff)
+				a.updateDevice(device.name, func(d *wlanDevice) {
+					d.enableOnEthernetDown = true
+				})
+			}
+		} else if device.enableOnEthernetDown {
+			lidClosed := a.service.GetLidState() == service.LidClosed
+			a.updateDevice(device.name, func(d *wlanDevice) {
+				d.enableOnEthernetDown = false
+				if lidClosed {
+					// lid automation will restore it when lid opens again
+					d.enableOnLidOpen = true
+				}
+			})
+			if !lidClosed {
+				a.setWlanStateByAutomation(device.name, service.WlanPowerOn)
+			}
+		}
+	}
+}
@@ -0,0 +1,393 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package automation
+
+import (
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/config"
+	"github.com/manuel-koch/go-auto-wlan/service"
+	"github.com/manuel-koch/go-auto-wlan/utils/clocktest"
+)
+
+// fakeController is a service whose state only changes by the test and by switching devices,
+// it records the switched devices like "wlan0 off".
+type fakeController struct {
+	mutex           sync.Mutex
+	lidState        service.LidState
+	wlanDevices     []service.WlanDevice
+	ethernetDevices []service.EthernetDevice
+	powerState      service.PowerState
+	bluetoothState  service.BluetoothState
+	switched        []string
+}
+
+func newFakeController(devices ...service.WlanDevice) *fakeController {
+	return &fakeController{
+		lidState:       service.LidOpen,
+		wlanDevices:    devices,
+		powerState:     service.PowerState{Source: service.PowerSourceBattery, Percentage: 80},
+		bluetoothState: service.BluetoothPowerOn,
+	}
+}
+
+func (c *fakeController) GetLidState() service.LidState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lidState
+}
+
+func (c *fakeController) GetWlanDevices() []service.WlanDevice {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return service.CopyWlanDevices(c.wlanDevices)
+}
+
+func (c *fakeController) GetPowerState() service.PowerState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.powerState
+}
+
+func (c *fakeController) GetEthernetDevices() []service.EthernetDevice {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return service.CopyEthernetDevices(c.ethernetDevices)
+}
+
+func (c *fakeController) GetBluetoothState() service.BluetoothState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.bluetoothState
+}
+
+func (c *fakeController) SetWlanState(device string, state service.WlanState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.switched = append(c.switched, device+" "+service.WlanStateToString(state))
+	for i := range c.wlanDevices {
+		if c.wlanDevices[i].Name == device {
+			c.wlanDevices[i].State = state
+		}
+	}
+}
+
+func (c *fakeController) SetBluetoothState(state service.BluetoothState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.switched = append(c.switched, "bluetooth "+service.BluetoothStateToString(state))
+	c.bluetoothState = state
+}
+
+func (c *fakeController) Notify(title, message string) {}
+
+func (c *fakeController) Subscripe() *service.EventSubscription {
+	return nil
+}
+
+func (c *fakeController) setLidState(lidState service.LidState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lidState = lidState
+}
+
+func (c *fakeController) setEthernetLink(link service.EthernetLinkState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ethernetDevices = []service.EthernetDevice{{Name: "eth0", Link: link}}
+}
+
+// takeSwitched returns the devices switched since the last call.
+func (c *fakeController) takeSwitched() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switched := c.switched
+	c.switched = nil
+	return switched
+}
+
+// newTestAutomation returns the automation of given controller using config and state in given directory,
+// the config is changed by given function before the automation picks up the devices.
+func newTestAutomation(t *testing.T, dir string, controller *fakeController, change func(cfg *config.Config)) *Automation {
+	t.Helper()
+	configPath := filepath.Join(dir, "config.yaml")
+	cfg := config.NewConfig(configPath)
+	if change != nil {
+		change(cfg)
+	}
+	state, err := config.LoadState(config.StatePath(configPath))
+	if err != nil {
+		t.Fatalf("LoadState() failed: %v", err)
+	}
+	clock := clocktest.NewFakeClock(time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+	a := NewAutomation(controller, cfg, state, clock, nil)
+	a.updateDevices(controller.GetWlanDevices())
+	return a
+}
+
+// changeLid changes the lid of given controller and lets the automation handle it.
+func changeLid(a *Automation, controller *fakeController, lidState service.LidState) {
+	controller.setLidState(lidState)
+	a.handleLidEvent(service.LidStateChangedEvent{LidState: lidState})
+}
+
+// changeEthernetLink changes the wired link of given controller and lets the automation handle it.
+func changeEthernetLink(a *Automation, controller *fakeController, link service.EthernetLinkState) {
+	controller.setEthernetLink(link)
+	a.applyEthernetPolicy(controller.GetEthernetDevices())
+}
+
+func TestLidOpenKeepsWlanOffWhileWired(t *testing.T) {
+	controller := newFakeController(service.WlanDevice{Name: "wlan0", State: service.WlanPowerOn, Network: "Cafe"})
+	a := newTestAutomation(t, t.TempDir(), controller, func(cfg *config.Config) { cfg.WlanOffOnEthernet = true })
+
+	changeLid(a, controller, service.LidClosed)
+	if switched := controller.takeSwitched(); !slices.Equal(switched, []string{"wlan0 off"}) {
+		t.Fatalf("switched on lid close = %v, want wlan0 off", switched)
+	}
+
+	// plugging the cable while WLAN is already off changes nothing
+	changeEthernetLink(a, controller, service.EthernetLinkUp)
+	if switched := controller.takeSwitched(); len(switched) != 0 {
+		t.Fatalf("switched on wired link up = %v, want nothing", switched)
+	}
+
+	changeLid(a, controller, service.LidOpen)
+	if switched := controller.takeSwitched(); len(switched) != 0 {
+		t.Fatalf("switched on lid open while wired = %v, want nothing", switched)
+	}
+	if switchedOff := a.state.SwitchedOffDevices(); !slices.Equal(switchedOff, []string{"wlan0"}) {
+		t.Errorf("switched off devices while wired = %v, want wlan0", switchedOff)
+	}
+
+	changeEthernetLink(a, controller, service.EthernetLinkDown)
+	if switched := controller.takeSwitched(); !slices.Equal(switched, []string{"wlan0 on"}) {
+		t.Fatalf("switched on wired link down = %v, want wlan0 on", switched)
+	}
+	if switchedOff := a.state.SwitchedOffDevices(); len(switchedOff) != 0 {
+		t.Errorf("switched off devices after restore = %v, want none", switchedOff)
+	}
+}
+
+func TestLidPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		devices   []service.WlanDevice
+		change    func(cfg *config.Config)
+		clamshell bool
+		wantClose []string
+		wantOpen  []string
+	}{
+		{
+			name:      "switches off and on",
+			devices:   []service.WlanDevice{{Name: "wlan0", State: service.WlanPowerOn, Network: "Cafe"}},
+			wantClose: []string{"wlan0 off"},
+			wantOpen:  []string{"wlan0 on"},
+		},
+		{
+			name:    "keeps devices switched off by user off",
+			devices: []service.WlanDevice{{Name: "wlan0", State: service.WlanPowerOff}},
+		},
+		{
+			name: "keeps device on trusted network on",
+			devices: []service.WlanDevice{
+				{Name: "wlan0", State: service.WlanPowerOn, Network: "Office"},
+				{Name: "wlan1", State: service.WlanPowerOn, Network: "Cafe"},
+			},
+			change:    func(cfg *config.Config) { cfg.TrustedNetworks = []string{"Office"} },
+			wantClose: []string{"wlan1 off"},
+			wantOpen:  []string{"wlan1 on"},
+		},
+		{
+			name:      "keeps radios on in clamshell mode",
+			devices:   []service.WlanDevice{{Name: "wlan0", State: service.WlanPowerOn, Network: "Cafe"}},
+			change:    func(cfg *config.Config) { cfg.ToggleBluetoothOnLid = true },
+			clamshell: true,
+		},
+		{
+			name:      "switches off in clamshell mode when configured",
+			devices:   []service.WlanDevice{{Name: "wlan0", State: service.WlanPowerOn, Network: "Cafe"}},
+			change:    func(cfg *config.Config) { cfg.KeepOnInClamshell = false },
+			clamshell: true,
+			wantClose: []string{"wlan0 off"},
+			wantOpen:  []string{"wlan0 on"},
+		},
+		{
+			name: "keeps device not toggled on lid on",
+			devices: []service.WlanDevice{
+				{Name: "wlan0", State: service.WlanPowerOn, Network: "Cafe"},
+				{Name: "wlan1", State: service.WlanPowerOn, Network: "Cafe"},
+			},
+			change: func(cfg *config.Config) {
+				cfg.Devices["wlan1"] = config.DeviceConfig{ToggleOnLid: false, RestoreOnLidOpen: true}
+			},
+			wantClose: []string{"wlan0 off"},
+			wantOpen:  []string{"wlan0 on"},
+		},
+		{
+			name:      "keeps device not restored on lid open off",
+			devices:   []service.WlanDevice{{Name: "wlan0", State: service.WlanPowerOn, Network: "Cafe"}},
+			change:    func(cfg *config.Config) { cfg.Devices["wlan0"] = config.DeviceConfig{ToggleOnLid: true} },
+			wantClose: []string{"wlan0 off"},
+		},
+		{
+			name:    "keeps radios on when disabled",
+			devices: []service.WlanDevice{{Name: "wlan0", State: service.WlanPowerOn, Network: "Cafe"}},
+			change:  func(cfg *config.Config) { cfg.ToggleWlanOnLid = false },
+		},
+		{
+			name:      "switches bluetooth off and on",
+			devices:   []service.WlanDevice{{Name: "wlan0", State: service.WlanPowerOn, Network: "Cafe"}},
+			change:    func(cfg *config.Config) { cfg.ToggleBluetoothOnLid = true },
+			wantClose: []string{"wlan0 off", "bluetooth off"},
+			wantOpen:  []string{"wlan0 on", "bluetooth on"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := newFakeController(tt.devices...)
+			a := newTestAutomation(t, t.TempDir(), controller, tt.change)
+
+			controller.setLidState(service.LidClosed)
+			a.handleLidEvent(service.LidStateChangedEvent{LidState: service.LidClosed, Clamshell: tt.clamshell})
+			if switched := controller.takeSwitched(); !slices.Equal(switched, tt.wantClose) {
+				t.Errorf("switched on lid close = %v, want %v", switched, tt.wantClose)
+			}
+
+			changeLid(a, controller, service.LidOpen)
+			if switched := controller.takeSwitched(); !slices.Equal(switched, tt.wantOpen) {
+				t.Errorf("switched on lid open = %v, want %v", switched, tt.wantOpen)
+			}
+			if switchedOff := a.state.SwitchedOffDevices(); len(switchedOff) != 0 {
+				t.Errorf("switched off devices after lid open = %v, want none", switchedOff)
+			}
+		})
+	}
+}
+
+func TestLidClosePersistsSwitchedOffDevices(t *testing.T) {
+	dir := t.TempDir()
+	statePath := config.StatePath(filepath.Join(dir, "config.yaml"))
+	controller := newFakeController(service.WlanDevice{Name: "wlan0", State: service.WlanPowerOn, Network: "Cafe"})
+	a := newTestAutomation(t, dir, controller, nil)
+
+	changeLid(a, controller, service.LidClosed)
+	state, err := config.LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if switchedOff := state.SwitchedOffDevices(); !slices.Equal(switchedOff, []string{"wlan0"}) {
+		t.Errorf("saved switched off devices = %v, want wlan0", switchedOff)
+	}
+
+	// a restart while the lid is closed keeps the device off until the lid opens
+	controller.takeSwitched()
+	restarted := newTestAutomation(t, dir, controller, nil)
+	if switched := controller.takeSwitched(); len(switched) != 0 {
+		t.Errorf("switched on restart = %v, want nothing", switched)
+	}
+	changeLid(restarted, controller, service.LidOpen)
+	if switched := controller.takeSwitched(); !slices.Equal(switched, []string{"wlan0 on"}) {
+		t.Errorf("switched on lid open = %v, want wlan0 on", switched)
+	}
+	state, err = config.LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if switchedOff := state.SwitchedOffDevices(); len(switchedOff) != 0 {
+		t.Errorf("saved switched off devices after lid open = %v, want none", switchedOff)
+	}
+}
+
+// TestPolicyRunsConcurrently applies the lid policy and reapplies the ethernet policy from different goroutines,
+// like the event and reload goroutines do, run with -race to detect unguarded automation state.
+func TestPolicyRunsConcurrently(t *testing.T) {
+	controller := newFakeController(service.WlanDevice{Name: "wlan0", State: service.WlanPowerOn, Network: "Cafe"})
+	controller.setEthernetLink(service.EthernetLinkUp)
+	a := newTestAutomation(t, t.TempDir(), controller, func(cfg *config.Config) {
+		cfg.WlanOffOnEthernet = true
+		cfg.ToggleBluetoothOnLid = true
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			changeLid(a, controller, service.LidClosed)
+			changeLid(a, controller, service.LidOpen)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			a.ApplyEthernetPolicy()
+		}
+	}()
+	wg.Wait()
+
+	// the wired link kept WLAN off whichever policy switched it off, the lid restored Bluetooth
+	devices := controller.GetWlanDevices()
+	if devices[0].State != service.WlanPowerOff {
+		t.Errorf("wlan0 = %s while wired, want off", service.WlanStateToString(devices[0].State))
+	}
+	if switchedOff := a.state.SwitchedOffDevices(); !slices.Equal(switchedOff, []string{"wlan0"}) {
+		t.Errorf("switched off devices while wired = %v, want wlan0", switchedOff)
+	}
+	if bluetoothState := controller.GetBluetoothState(); bluetoothState != service.BluetoothPowerOn {
+		t.Errorf("bluetooth = %s after lid open, want on", service.BluetoothStateToString(bluetoothState))
+	}
+
+	changeEthernetLink(a, controller, service.EthernetLinkDown)
+	if devices := controller.GetWlanDevices(); devices[0].State != service.WlanPowerOn {
+		t.Errorf("wlan0 = %s after wired link down, want on", service.WlanStateToString(devices[0].State))
+	}
+	if switchedOff := a.state.SwitchedOffDevices(); len(switchedOff) != 0 {
+		t.Errorf("switched off devices after wired link down = %v, want none", switchedOff)
+	}
+}
+
+// TestBluetoothLidPolicyRunsConcurrently handles lid events from different goroutines,
+// run with -race to detect unguarded Bluetooth automation state.
+func TestBluetoothLidPolicyRunsConcurrently(t *testing.T) {
+	controller := newFakeController()
+	a := newTestAutomation(t, t.TempDir(), controller, func(cfg *config.Config) {
+		cfg.ToggleBluetoothOnLid = true
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				a.handleLidEvent(service.LidStateChangedEvent{LidState: service.LidClosed})
+				a.handleLidEvent(service.LidStateChangedEvent{LidState: service.LidOpen})
+			}
+		}()
+	}
+	wg.Wait()
+
+	a.handleLidEvent(service.LidStateChangedEvent{LidState: service.LidOpen})
+	if bluetoothState := controller.GetBluetoothState(); bluetoothState != service.BluetoothPowerOn {
+		t.Errorf("bluetooth = %s after lid open, want on", service.BluetoothStateToString(bluetoothState))
+	}
+}
@@ -0,0 +1,117 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package automation
+
+import (
+	"sync"
+	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/utils"
+)
+
+// delayedAction runs an action after a delay that can be cancelled,
+// reporting the remaining time every second while pending.
+type delayedAction struct {
+	mutex     sync.Mutex
+	clock     utils.Clock
+	deadline  time.Time
+	timer     utils.Timer
+	countdown utils.Timer
+	// onTick gets the remaining time, zero once the action ran or got cancelled.
+	onTick func(remaining time.Duration)
+}
+
+func newDelayedAction(clock utils.Clock, onTick func(remaining time.Duration)) *delayedAction {
+	return &delayedAction{clock: clock, onTick: onTick}
+}
+
+// Start runs given action after given delay, replacing a pending action.
+func (d *delayedAction) Start(delay time.Duration, action func()) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.stop()
+
+	var timer utils.Timer
+	timer = d.clock.AfterFunc(delay, func() {
+		d.mutex.Lock()
+		if d.timer != timer {
+			// replaced or cancelled meanwhile
+			d.mutex.Unlock()
+			return
+		}
+		d.stop()
+		d.mutex.Unlock()
+		d.onTick(0)
+		action()
+	})
+	d.timer = timer
+	d.deadline = d.clock.Now().Add(delay)
+	d.tick()
+}
+
+// Cancel prevents the pending action, returns whether there was one.
+func (d *delayedAction) Cancel() bool {
+	d.mutex.Lock()
+	pending := d.timer != nil
+	d.stop()
+	d.mutex.Unlock()
+	if pending {
+		d.onTick(0)
+	}
+	return pending
+}
+
+// Pending returns whether an action is waiting to run.
+func (d *delayedAction) Pending() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.timer != nil
+}
+
+// tick reports the remaining time and schedules the next report,
+// caller must hold the mutex.
+func (d *delayedAction) tick() {
+	remaining := d.deadline.Sub(d.clock.Now())
+	if remaining <= 0 {
+		return
+	}
+	d.onTick(remaining)
+	timer := d.timer
+	next := remaining % time.Second
+	if next == 0 {
+		next = time.Second
+	}
+	d.countdown = d.clock.AfterFunc(next, func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		if d.timer == timer {
+			d.tick()
+		}
+	})
+}
+
+// stop cancels pending timers, caller must hold the mutex.
+func (d *delayedAction) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.countdown != nil {
+		d.countdown.Stop()
+		d.countdown = nil
+	}
+}
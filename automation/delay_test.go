@@ -0,0 +1,102 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package automation
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/utils/clocktest"
+)
+
+// newTestDelayedAction returns a delayed action on a fake clock,
+// collecting the reported remaining times.
+func newTestDelayedAction() (*delayedAction, *clocktest.FakeClock, *[]time.Duration) {
+	clock := clocktest.NewFakeClock(time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+	ticks := make([]time.Duration, 0)
+	return newDelayedAction(clock, func(remaining time.Duration) { ticks = append(ticks, remaining) }), clock, &ticks
+}
+
+func TestDelayedActionExpires(t *testing.T) {
+	d, clock, ticks := newTestDelayedAction()
+	ran := 0
+	d.Start(3*time.Second, func() { ran++ })
+	if !d.Pending() {
+		t.Fatalf("Pending() after Start = false")
+	}
+
+	clock.Advance(2 * time.Second)
+	if ran != 0 {
+		t.Fatalf("action ran before delay")
+	}
+	clock.Advance(time.Second)
+	if ran != 1 {
+		t.Fatalf("action ran %d times after delay, want once", ran)
+	}
+	if d.Pending() {
+		t.Errorf("Pending() after action ran = true")
+	}
+	if want := []time.Duration{3 * time.Second, 2 * time.Second, time.Second, 0}; !slices.Equal(*ticks, want) {
+		t.Errorf("remaining times = %v, want %v", *ticks, want)
+	}
+	if clock.Pending() != 0 {
+		t.Errorf("%d timers left after action ran", clock.Pending())
+	}
+}
+
+func TestDelayedActionCancel(t *testing.T) {
+	d, clock, ticks := newTestDelayedAction()
+	ran := 0
+	d.Start(30*time.Second, func() { ran++ })
+
+	// lid reopened within the grace period
+	clock.Advance(10 * time.Second)
+	if !d.Cancel() {
+		t.Fatalf("Cancel() of pending action = false")
+	}
+	if d.Cancel() {
+		t.Errorf("Cancel() without pending action = true")
+	}
+	clock.Advance(time.Minute)
+	if ran != 0 {
+		t.Errorf("cancelled action ran")
+	}
+	if last := (*ticks)[len(*ticks)-1]; last != 0 {
+		t.Errorf("last remaining time after cancel = %s, want 0", last)
+	}
+	if clock.Pending() != 0 {
+		t.Errorf("%d timers left after cancel", clock.Pending())
+	}
+}
+
+func TestDelayedActionStartReplaces(t *testing.T) {
+	d, clock, _ := newTestDelayedAction()
+	first, second := 0, 0
+	d.Start(30*time.Second, func() { first++ })
+	clock.Advance(10 * time.Second)
+	d.Start(5*time.Second, func() { second++ })
+
+	clock.Advance(5 * time.Second)
+	if second != 1 {
+		t.Errorf("replacing action ran %d times, want once", second)
+	}
+	clock.Advance(time.Minute)
+	if first != 0 {
+		t.Errorf("replaced action ran")
+	}
+}
@@ -0,0 +1,324 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/manuel-koch/go-auto-wlan/service"
+)
+
+// Exit codes of the subcommands.
+const (
+	ExitSuccess = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+)
+
+// allDevices selects every WLAN device in "on", "off" and "toggle".
+const allDevices = "all"
+
+// Status is the state reported by "status --json".
+type Status struct {
+	Lid       string           `json:"lid"`
+	Clamshell bool             `json:"clamshell"`
+	Devices   []DeviceStatus   `json:"devices"`
+	Bluetooth string           `json:"bluetooth,omitempty"`
+	Ethernet  []EthernetStatus `json:"ethernet,omitempty"`
+	Power     *PowerStatus     `json:"power,omitempty"`
+}
+
+type DeviceStatus struct {
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Network string `json:"network,omitempty"`
+	Signal  int    `json:"signal,omitempty"`
+}
+
+type EthernetStatus struct {
+	Name string `json:"name"`
+	Port string `json:"port,omitempty"`
+	Link string `json:"link"`
+}
+
+type PowerStatus struct {
+	Source string `json:"source"`
+	// Percentage is the battery level, -1 if there is no battery.
+	Percentage int `json:"percentage"`
+}
+
+// CLI runs subcommands against the service backends,
+// without starting the service itself.
+type CLI struct {
+	backends service.Backends
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+func NewCLI(backends service.Backends, stdout, stderr io.Writer) *CLI {
+	return &CLI{backends: backends, stdout: stdout, stderr: stderr}
+}
+
+// IsSubcommand returns whether given name is a known subcommand.
+func IsSubcommand(name string) bool {
+	return slices.Contains([]string{"status", "on", "off", "toggle", "lid", "devices"}, name)
+}
+
+// Usage prints the available subcommands.
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "Subcommands:")
+	fmt.Fprintln(w, "  status [--json]            Show lid, WLAN, Bluetooth, Ethernet and power state")
+	fmt.Fprintln(w, "  on|off|toggle <device|all> Switch WLAN power of named device or all devices")
+	fmt.Fprintln(w, "  lid                        Show lid state")
+	fmt.Fprintln(w, "  devices                    List WLAN devices")
+}
+
+// Run runs the subcommand given by args, returns the exit code.
+func (c *CLI) Run(args []string) int {
+	if len(args) == 0 {
+		Usage(c.stderr)
+		return ExitUsage
+	}
+	switch args[0] {
+	case "status":
+		return c.status(args[1:])
+	case "on":
+		return c.setPower(args[1:], func(service.WlanState) service.WlanState { return service.WlanPowerOn })
+	case "off":
+		return c.setPower(args[1:], func(service.WlanState) service.WlanState { return service.WlanPowerOff })
+	case "toggle":
+		return c.setPower(args[1:], func(state service.WlanState) service.WlanState {
+			if state == service.WlanPowerOn {
+				return service.WlanPowerOff
+			}
+			return service.WlanPowerOn
+		})
+	case "lid":
+		return c.lid(args[1:])
+	case "devices":
+		return c.devices(args[1:])
+	default:
+		fmt.Fprintf(c.stderr, "Unknown subcommand '%s'\n", args[0])
+		Usage(c.stderr)
+		return ExitUsage
+	}
+}
+
+func (c *CLI) status(args []string) int {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	jsonOutput := flags.Bool("json", false, "Print status as JSON")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		return ExitUsage
+	}
+
+	status, err := c.queryStatus()
+	if err != nil {
+		fmt.Fprintf(c.stderr, "Failed to get status: %v\n", err)
+		return ExitFailure
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(status); err != nil {
+			fmt.Fprintf(c.stderr, "Failed to print status: %v\n", err)
+			return ExitFailure
+		}
+		return ExitSuccess
+	}
+
+	if status.Clamshell {
+		fmt.Fprintf(c.stdout, "Lid: %s (clamshell mode)\n", status.Lid)
+	} else {
+		fmt.Fprintf(c.stdout, "Lid: %s\n", status.Lid)
+	}
+	for _, device := range status.Devices {
+		fmt.Fprintf(c.stdout, "WLAN %s\n", formatDevice(device))
+	}
+	if len(status.Bluetooth) > 0 {
+		fmt.Fprintf(c.stdout, "Bluetooth: %s\n", status.Bluetooth)
+	}
+	for _, device := range status.Ethernet {
+		fmt.Fprintf(c.stdout, "Ethernet %s: %s\n", device.Name, device.Link)
+	}
+	if status.Power != nil {
+		if status.Power.Percentage >= 0 {
+			fmt.Fprintf(c.stdout, "Power: %s (%d%%)\n", status.Power.Source, status.Power.Percentage)
+		} else {
+			fmt.Fprintf(c.stdout, "Power: %s\n", status.Power.Source)
+		}
+	}
+	return ExitSuccess
+}
+
+func (c *CLI) queryStatus() (*Status, error) {
+	// desktops and servers have no lid, still report the other states
+	lidState, err := c.backends.Lid.GetLidState()
+	if err != nil {
+		lidState = service.LidUnknown
+	}
+	status := &Status{Lid: service.LidStateToString(lidState), Devices: make([]DeviceStatus, 0)}
+	if lidState == service.LidClosed {
+		if externalDisplay, err := c.backends.Lid.HasExternalDisplay(); err == nil {
+			status.Clamshell = externalDisplay
+		}
+	}
+
+	devices, err := c.backends.Wlan.GetWlanDevices()
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		status.Devices = append(status.Devices, newDeviceStatus(device))
+	}
+
+	// optional backends only add to the status when available
+	if c.backends.Bluetooth != nil {
+		if state, err := c.backends.Bluetooth.GetBluetoothState(); err == nil {
+			status.Bluetooth = service.BluetoothStateToString(state)
+		}
+	}
+	if c.backends.Ethernet != nil {
+		if ethernetDevices, err := c.backends.Ethernet.GetEthernetDevices(); err == nil {
+			for _, device := range ethernetDevices {
+				status.Ethernet = append(status.Ethernet, EthernetStatus{
+					Name: device.Name,
+					Port: device.Port,
+					Link: service.EthernetLinkStateToString(device.Link),
+				})
+			}
+		}
+	}
+	if c.backends.Power != nil {
+		if powerState, err := c.backends.Power.GetPowerState(); err == nil {
+			status.Power = &PowerStatus{
+				Source:     service.PowerSourceToString(powerState.Source),
+				Percentage: powerState.Percentage,
+			}
+		}
+	}
+	return status, nil
+}
+
+// setPower switches named device or all devices to the state returned by given function,
+// which gets the current state of the device or of the first device that isn't hard blocked.
+func (c *CLI) setPower(args []string, newState func(state service.WlanState) service.WlanState) int {
+	if len(args) != 1 {
+		fmt.Fprintln(c.stderr, "Expected one device name or 'all'")
+		return ExitUsage
+	}
+	name := args[0]
+
+	devices, err := c.backends.Wlan.GetWlanDevices()
+	if err != nil {
+		fmt.Fprintf(c.stderr, "Failed to get WLAN devices: %v\n", err)
+		return ExitFailure
+	}
+	if name != allDevices {
+		i := slices.IndexFunc(devices, func(d service.WlanDevice) bool { return d.Name == name })
+		if i < 0 {
+			fmt.Fprintf(c.stderr, "Unknown WLAN device '%s'\n", name)
+			return ExitFailure
+		}
+		if devices[i].State == service.WlanHardBlocked {
+			fmt.Fprintf(c.stderr, "WLAN %s is hard blocked, can't switch it\n", name)
+			return ExitFailure
+		}
+		devices = devices[i : i+1]
+	}
+
+	// a radio blocked by hardware switch can't be switched by us
+	switchable := make([]service.WlanDevice, 0, len(devices))
+	for _, device := range devices {
+		if device.State == service.WlanHardBlocked {
+			fmt.Fprintf(c.stdout, "WLAN %s is hard blocked, skipping it\n", device.Name)
+			continue
+		}
+		switchable = append(switchable, device)
+	}
+	if len(switchable) == 0 {
+		return ExitSuccess
+	}
+
+	// all devices are switched to the same state, toggling each device on its own
+	// would switch a radio shared by the devices, like the one of nmcli, back and forth
+	state := newState(switchable[0].State)
+	exitCode := ExitSuccess
+	for _, device := range switchable {
+		if err := c.backends.Wlan.SetWlanState(device.Name, state); err != nil {
+			fmt.Fprintf(c.stderr, "Failed to switch WLAN %s %s: %v\n", device.Name, service.WlanStateToString(state), err)
+			exitCode = ExitFailure
+			continue
+		}
+		fmt.Fprintf(c.stdout, "WLAN %s switched %s\n", device.Name, service.WlanStateToString(state))
+	}
+	return exitCode
+}
+
+func (c *CLI) lid(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(c.stderr, "Unexpected arguments")
+		return ExitUsage
+	}
+	lidState, err := c.backends.Lid.GetLidState()
+	if err != nil {
+		fmt.Fprintf(c.stderr, "Failed to get lid state: %v\n", err)
+		return ExitFailure
+	}
+	fmt.Fprintln(c.stdout, service.LidStateToString(lidState))
+	return ExitSuccess
+}
+
+func (c *CLI) devices(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(c.stderr, "Unexpected arguments")
+		return ExitUsage
+	}
+	devices, err := c.backends.Wlan.GetWlanDevices()
+	if err != nil {
+		fmt.Fprintf(c.stderr, "Failed to get WLAN devices: %v\n", err)
+		return ExitFailure
+	}
+	for _, device := range devices {
+		fmt.Fprintln(c.stdout, formatDevice(newDeviceStatus(device)))
+	}
+	return ExitSuccess
+}
+
+func newDeviceStatus(device service.WlanDevice) DeviceStatus {
+	return DeviceStatus{
+		Name:    device.Name,
+		State:   service.WlanStateToString(device.State),
+		Network: device.Network,
+		Signal:  device.Signal,
+	}
+}
+
+func formatDevice(device DeviceStatus) string {
+	s := fmt.Sprintf("%s: %s", device.Name, device.State)
+	if len(device.Network) > 0 && device.Signal != 0 {
+		s += fmt.Sprintf(" (%s, %d dBm)", device.Network, device.Signal)
+	} else if len(device.Network) > 0 {
+		s += fmt.Sprintf(" (%s)", device.Network)
+	}
+	return s
+}
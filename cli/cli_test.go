@@ -0,0 +1,155 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/manuel-koch/go-auto-wlan/service"
+)
+
+// fakeWlanBackend reports fixed WLAN devices and records the switched states,
+// switching the failing device returns an error.
+type fakeWlanBackend struct {
+	devices []service.WlanDevice
+	failing string
+	set     []string
+}
+
+func (b *fakeWlanBackend) GetWlanDevices() ([]service.WlanDevice, error) {
+	return b.devices, nil
+}
+
+func (b *fakeWlanBackend) GetWlanState(device string) (service.WlanState, error) {
+	for _, d := range b.devices {
+		if d.Name == device {
+			return d.State, nil
+		}
+	}
+	return service.WlanUnknown, nil
+}
+
+func (b *fakeWlanBackend) SetWlanState(device string, state service.WlanState) error {
+	b.set = append(b.set, fmt.Sprintf("%s %s", device, service.WlanStateToString(state)))
+	if device == b.failing {
+		return errors.New("permission denied")
+	}
+	return nil
+}
+
+func (b *fakeWlanBackend) GetWlanNetwork(device string) (string, error) {
+	return "", nil
+}
+
+// newLidlessCLI returns a CLI for a machine without lid, e.g. a server.
+func newLidlessCLI(t *testing.T) (*CLI, *bytes.Buffer, *bytes.Buffer) {
+	backends := service.Backends{
+		Wlan: &fakeWlanBackend{devices: []service.WlanDevice{{Name: "wlan0", State: service.WlanPowerOn, Network: "Office"}}},
+		Lid:  service.NewAcpiLidSensor(t.TempDir()),
+	}
+	var stdout, stderr bytes.Buffer
+	return NewCLI(backends, &stdout, &stderr), &stdout, &stderr
+}
+
+func TestStatusWithoutLid(t *testing.T) {
+	c, stdout, stderr := newLidlessCLI(t)
+	if code := c.Run([]string{"status", "--json"}); code != ExitSuccess {
+		t.Fatalf("status exit code = %d, want %d: %s", code, ExitSuccess, stderr.String())
+	}
+	var status Status
+	if err := json.Unmarshal(stdout.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Lid != "unknown" {
+		t.Errorf("lid = %s, want unknown", status.Lid)
+	}
+	if len(status.Devices) != 1 || status.Devices[0].Name != "wlan0" || status.Devices[0].Network != "Office" {
+		t.Errorf("devices = %+v, want wlan0 connected to Office", status.Devices)
+	}
+}
+
+func TestLidWithoutLid(t *testing.T) {
+	c, _, _ := newLidlessCLI(t)
+	if code := c.Run([]string{"lid"}); code != ExitFailure {
+		t.Errorf("lid exit code = %d, want %d", code, ExitFailure)
+	}
+}
+
+func TestSetPower(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		failing  string
+		wantCode int
+		wantSet  []string
+	}{
+		{name: "on device", args: []string{"on", "wlan1"}, wantCode: ExitSuccess, wantSet: []string{"wlan1 on"}},
+		{name: "off device", args: []string{"off", "wlan0"}, wantCode: ExitSuccess, wantSet: []string{"wlan0 off"}},
+		{name: "toggle device on", args: []string{"toggle", "wlan0"}, wantCode: ExitSuccess, wantSet: []string{"wlan0 off"}},
+		{name: "toggle device off", args: []string{"toggle", "wlan1"}, wantCode: ExitSuccess, wantSet: []string{"wlan1 on"}},
+		{name: "on all", args: []string{"on", "all"}, wantCode: ExitSuccess, wantSet: []string{"wlan0 on", "wlan1 on"}},
+		{name: "off all", args: []string{"off", "all"}, wantCode: ExitSuccess, wantSet: []string{"wlan0 off", "wlan1 off"}},
+		// all devices follow the first one, a shared radio isn't switched back and forth
+		{name: "toggle all", args: []string{"toggle", "all"}, wantCode: ExitSuccess, wantSet: []string{"wlan0 off", "wlan1 off"}},
+		{name: "on unknown device", args: []string{"on", "wlan9"}, wantCode: ExitFailure},
+		{name: "off unknown device", args: []string{"off", "wlan9"}, wantCode: ExitFailure},
+		{name: "toggle unknown device", args: []string{"toggle", "wlan9"}, wantCode: ExitFailure},
+		{name: "on hard blocked device", args: []string{"on", "wlan2"}, wantCode: ExitFailure},
+		{name: "toggle hard blocked device", args: []string{"toggle", "wlan2"}, wantCode: ExitFailure},
+		{name: "failing device", args: []string{"off", "wlan0"}, failing: "wlan0", wantCode: ExitFailure, wantSet: []string{"wlan0 off"}},
+		{name: "on all with failing device", args: []string{"on", "all"}, failing: "wlan0", wantCode: ExitFailure, wantSet: []string{"wlan0 on", "wlan1 on"}},
+		{name: "toggle all with failing device", args: []string{"toggle", "all"}, failing: "wlan0", wantCode: ExitFailure, wantSet: []string{"wlan0 off", "wlan1 off"}},
+		{name: "without device", args: []string{"on"}, wantCode: ExitUsage},
+		{name: "with several devices", args: []string{"off", "wlan0", "wlan1"}, wantCode: ExitUsage},
+		{name: "toggle without device", args: []string{"toggle"}, wantCode: ExitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &fakeWlanBackend{
+				devices: []service.WlanDevice{
+					{Name: "wlan0", State: service.WlanPowerOn},
+					{Name: "wlan1", State: service.WlanPowerOff},
+					{Name: "wlan2", State: service.WlanHardBlocked},
+				},
+				failing: tt.failing,
+			}
+			var stdout, stderr bytes.Buffer
+			c := NewCLI(service.Backends{Wlan: backend}, &stdout, &stderr)
+			if code := c.Run(tt.args); code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d: %s", code, tt.wantCode, stderr.String())
+			}
+			if !slices.Equal(backend.set, tt.wantSet) {
+				t.Errorf("switched %v, want %v", backend.set, tt.wantSet)
+			}
+		})
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	for _, args := range [][]string{{}, {"reboot"}, {"lid", "open"}, {"devices", "wlan0"}, {"status", "--yaml"}} {
+		var stdout, stderr bytes.Buffer
+		c := NewCLI(service.Backends{Wlan: &fakeWlanBackend{}}, &stdout, &stderr)
+		if code := c.Run(args); code != ExitUsage {
+			t.Errorf("Run(%q) exit code = %d, want %d", args, code, ExitUsage)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/rules"
+	"github.com/manuel-koch/go-auto-wlan/service"
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaVersion is the version of the config file layout written by this version.
+const SchemaVersion = 1
+
+// DefaultLowBatteryPercentage is the battery percentage below which
+// radios are always switched off on lid close, when enabled.
+const DefaultLowBatteryPercentage = 20
+
+// Config is the persistent configuration of the app.
+type Config struct {
+	Version   int             `yaml:"version"`
+	Log       LogConfig       `yaml:"log"`
+	Intervals IntervalsConfig `yaml:"intervals"`
+
+	ToggleWlanOnLid      bool          `yaml:"toggle_wlan_on_lid"`
+	KeepOnInClamshell    bool          `yaml:"keep_on_in_clamshell"`
+	OnlyOnBattery        bool          `yaml:"only_on_battery"`
+	OffOnLowBattery      bool          `yaml:"off_on_low_battery"`
+	LowBatteryPercentage int           `yaml:"low_battery_percentage"`
+	WlanOffOnEthernet    bool          `yaml:"wlan_off_on_ethernet"`
+	ToggleBluetoothOnLid bool          `yaml:"toggle_bluetooth_on_lid"`
+	LidCloseDelay        time.Duration `yaml:"lid_close_delay"`
+	TrustedNetworks      []string      `yaml:"trusted_networks"`
+
+	// Devices are the settings of WLAN devices by device name.
+	Devices map[string]DeviceConfig `yaml:"devices"`
+	Rules   []rules.Rule            `yaml:"rules"`
+
+	path string
+}
+
+// LogConfig are the log options, command line flags take precedence.
+type LogConfig struct {
+	Level string `yaml:"level"`
+	Path  string `yaml:"path"`
+	JSON  bool   `yaml:"json"`
+}
+
+// IntervalsConfig are the poll intervals of the service.
+type IntervalsConfig struct {
+	Lid       time.Duration `yaml:"lid"`
+	Wlan      time.Duration `yaml:"wlan"`
+	Bluetooth time.Duration `yaml:"bluetooth"`
+	Ethernet  time.Duration `yaml:"ethernet"`
+	Power     time.Duration `yaml:"power"`
+}
+
+// DeviceConfig are the settings of one WLAN device.
+type DeviceConfig struct {
+	// ToggleOnLid selects whether the device is switched off on lid close.
+	ToggleOnLid bool `yaml:"toggle_on_lid"`
+	// LidCloseDelay overrides the global lid close delay when set.
+	LidCloseDelay *time.Duration `yaml:"lid_close_delay,omitempty"`
+	// RestoreOnLidOpen selects whether the device is switched on again on lid open.
+	RestoreOnLidOpen bool `yaml:"restore_on_lid_open"`
+}
+
+func NewDeviceConfig() DeviceConfig {
+	return DeviceConfig{ToggleOnLid: true, RestoreOnLidOpen: true}
+}
+
+// UnmarshalYAML keeps the defaults for settings missing in the config file.
+func (d *DeviceConfig) UnmarshalYAML(value *yaml.Node) error {
+	type plain DeviceConfig
+	device := plain(NewDeviceConfig())
+	if err := value.Decode(&device); err != nil {
+		return err
+	}
+	*d = DeviceConfig(device)
+	return nil
+}
+
+// DefaultPath returns the path of the config file in the user's config directory,
+// e.g. "~/.config/autowlan/config.yaml" or "~/Library/Application Support/autowlan/config.yaml".
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "autowlan", "config.yaml"), nil
+}
+
+// NewConfig returns the default configuration, saved to given path.
+func NewConfig(path string) *Config {
+	return &Config{
+		Version: SchemaVersion,
+		Log:     LogConfig{Level: "INFO"},
+		Intervals: IntervalsConfig{
+			Lid:       service.LidUpdateInterval,
+			Wlan:      service.WlanUpdateInterval,
+			Bluetooth: service.BluetoothUpdateInterval,
+			Ethernet:  service.EthernetUpdateInterval,
+			Power:     service.PowerUpdateInterval,
+		},
+		ToggleWlanOnLid:      true,
+		KeepOnInClamshell:    true,
+		LowBatteryPercentage: DefaultLowBatteryPercentage,
+		TrustedNetworks:      make([]string, 0),
+		Devices:              map[string]DeviceConfig{},
+		Rules:                make([]rules.Rule, 0),
+		path:                 path,
+	}
+}
+
+// Load loads the configuration from YAML file at given path,
+// returns the default configuration when the file doesn't exist yet.
+// Durations need a unit, e.g. "30s", a bare number like 30 is rejected.
+func Load(path string) (*Config, error) {
+	config := NewConfig(path)
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		logger.Info(fmt.Sprintf("No config at %s, using defaults", path))
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, err
+	}
+	if config.Version < 0 || config.Version > SchemaVersion {
+		return nil, fmt.Errorf("unsupported config version %d, expected %d or older", config.Version, SchemaVersion)
+	}
+	config.Version = SchemaVersion
+	if config.LowBatteryPercentage < 1 || config.LowBatteryPercentage > 100 {
+		return nil, fmt.Errorf("invalid low battery percentage %d, expected 1 to 100", config.LowBatteryPercentage)
+	}
+	if config.Devices == nil {
+		config.Devices = map[string]DeviceConfig{}
+	}
+	for i := range config.Rules {
+		if err := config.Rules[i].Validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+	logger.Info(fmt.Sprintf("Loaded config from %s", path))
+	return config, nil
+}
+
+// Save writes the configuration to the path it was loaded from.
+func (c *Config) Save() error {
+	if err := writeYaml(c.path, c); err != nil {
+		return err
+	}
+	logger.Debug(fmt.Sprintf("Saved config to %s", c.path))
+	return nil
+}
+
+// SetPath changes the path the configuration is saved to.
+func (c *Config) SetPath(path string) {
+	c.path = path
+}
+
+// Device returns the settings of named WLAN device, defaults for unknown devices.
+func (c *Config) Device(name string) DeviceConfig {
+	if device, ok := c.Devices[name]; ok {
+		return device
+	}
+	return NewDeviceConfig()
+}
+
+// SetDevice changes the settings of named WLAN device.
+func (c *Config) SetDevice(name string, device DeviceConfig) {
+	c.Devices[name] = device
+}
+
+// DeviceLidCloseDelay returns the lid close delay of named WLAN device.
+func (c *Config) DeviceLidCloseDelay(name string) time.Duration {
+	if delay := c.Device(name).LidCloseDelay; delay != nil {
+		return *delay
+	}
+	return c.LidCloseDelay
+}
+
+// ApplyIntervals configures the poll intervals of the service,
+// must be called before the service is created.
+func (c *Config) ApplyIntervals() {
+	if c.Intervals.Lid > 0 {
+		service.LidUpdateInterval = c.Intervals.Lid
+	}
+	if c.Intervals.Wlan > 0 {
+		service.WlanUpdateInterval = c.Intervals.Wlan
+	}
+	if c.Intervals.Bluetooth > 0 {
+		service.BluetoothUpdateInterval = c.Intervals.Bluetooth
+	}
+	if c.Intervals.Ethernet > 0 {
+		service.EthernetUpdateInterval = c.Intervals.Ethernet
+	}
+	if c.Intervals.Power > 0 {
+		service.PowerUpdateInterval = c.Intervals.Power
+	}
+}
+
+// writeYaml writes given value as YAML file at given path.
+func writeYaml(path string, value interface{}) error {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// write to temporary file first, a crash must not leave a truncated file behind
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, buffer.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
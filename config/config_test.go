@@ -0,0 +1,172 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/rules"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadMissingFileReturnsDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := NewConfig(path); !reflect.DeepEqual(config, want) {
+		t.Errorf("Load() = %+v, want %+v", config, want)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Load() created %s", path)
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autowlan", "config.yaml")
+	deviceDelay := 30 * time.Second
+	config := NewConfig(path)
+	config.Intervals.Wlan = 5 * time.Second
+	config.LidCloseDelay = 2 * time.Minute
+	config.WlanOffOnEthernet = true
+	config.TrustedNetworks = []string{"Office"}
+	config.Devices["en1"] = DeviceConfig{ToggleOnLid: false, LidCloseDelay: &deviceDelay, RestoreOnLidOpen: true}
+	config.Devices["en7"] = NewDeviceConfig()
+	config.Rules = []rules.Rule{{
+		Name: "Offline at night",
+		When: rules.Condition{Lid: "closed", Time: "22:00-06:00", Networks: []string{"Home"}},
+		Actions: []rules.Action{
+			{Device: rules.AllDevices, Power: "off", Delay: 30 * time.Second},
+			{Notify: "WLAN switched off for the night"},
+		},
+	}}
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, config) {
+		t.Errorf("Load() = %+v, want %+v", loaded, config)
+	}
+}
+
+func TestLoadVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "missing", content: "toggle_wlan_on_lid: true\n"},
+		{name: "current", content: "version: 1\n"},
+		{name: "too new", content: "version: 2\n", wantErr: true},
+		{name: "negative", content: "version: -1\n", wantErr: true},
+		{name: "not a number", content: "version: one\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := Load(writeConfig(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && config.Version != SchemaVersion {
+				t.Errorf("Version = %d, want %d", config.Version, SchemaVersion)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "without actions", content: "rules:\n  - when: {lid: closed}\n"},
+		{name: "unknown lid state", content: "rules:\n  - when: {lid: ajar}\n    actions: [{device: all, power: \"off\"}]\n"},
+		{name: "unknown power source", content: "rules:\n  - when: {power: solar}\n    actions: [{device: all, power: \"off\"}]\n"},
+		{name: "invalid time range", content: "rules:\n  - when: {time: 25:00-06:00}\n    actions: [{device: all, power: \"off\"}]\n"},
+		{name: "action without device", content: "rules:\n  - when: {lid: closed}\n    actions: [{power: \"off\"}]\n"},
+		{name: "invalid power", content: "rules:\n  - when: {lid: closed}\n    actions: [{device: all, power: dim}]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeConfig(t, tt.content)); err == nil {
+				t.Errorf("Load() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestLoadRejectsDurationWithoutUnit(t *testing.T) {
+	for _, content := range []string{
+		"lid_close_delay: 30\n",
+		"intervals: {wlan: 5}\n",
+		"devices:\n  en1: {lid_close_delay: 30}\n",
+		"rules:\n  - when: {lid: closed}\n    actions: [{device: all, power: \"off\", delay: 30}]\n",
+	} {
+		if _, err := Load(writeConfig(t, content)); err == nil {
+			t.Errorf("Load(%q) succeeded, want error", content)
+		}
+	}
+}
+
+func TestLoadLowBatteryPercentage(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{name: "missing file", want: DefaultLowBatteryPercentage},
+		{name: "default", content: "off_on_low_battery: true\n", want: DefaultLowBatteryPercentage},
+		{name: "configured", content: "low_battery_percentage: 35\n", want: 35},
+		{name: "too low", content: "low_battery_percentage: 0\n", wantErr: true},
+		{name: "too high", content: "low_battery_percentage: 101\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if len(tt.content) > 0 {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			config, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && config.LowBatteryPercentage != tt.want {
+				t.Errorf("LowBatteryPercentage = %d, want %d", config.LowBatteryPercentage, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// State is the runtime state persisted across restarts of the app.
+type State struct {
+	mutex sync.Mutex
+	path  string
+
+	// SwitchedOff are the WLAN devices switched off by automation,
+	// to restore them when the app didn't get the chance to.
+	SwitchedOff []string `yaml:"switched_off"`
+}
+
+// StatePath returns the path of the state file next to the config file at given path.
+func StatePath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "state.yaml")
+}
+
+// LoadState loads the state from YAML file at given path,
+// returns an empty state when the file doesn't exist yet.
+func LoadState(path string) (*State, error) {
+	state := &State{path: path, SwitchedOff: make([]string, 0)}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(content, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// SwitchedOffDevices returns the devices switched off by automation.
+func (s *State) SwitchedOffDevices() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return slices.Clone(s.SwitchedOff)
+}
+
+// AddSwitchedOff records given device as switched off by automation.
+func (s *State) AddSwitchedOff(device string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if slices.Contains(s.SwitchedOff, device) {
+		return
+	}
+	s.SwitchedOff = append(s.SwitchedOff, device)
+	s.save()
+}
+
+// RemoveSwitchedOff clears given device once it got restored.
+func (s *State) RemoveSwitchedOff(device string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !slices.Contains(s.SwitchedOff, device) {
+		return
+	}
+	s.SwitchedOff = slices.DeleteFunc(s.SwitchedOff, func(d string) bool { return d == device })
+	s.save()
+}
+
+// save writes the state file, caller must hold the mutex.
+func (s *State) save() {
+	// encode a copy, the encoder reads the whole struct including the mutex
+	// while other goroutines may be waiting on it
+	if err := writeYaml(s.path, &State{SwitchedOff: s.SwitchedOff}); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save state: %v", err))
+		return
+	}
+	logger.Debug(fmt.Sprintf("Saved state to %s", s.path))
+}
@@ -0,0 +1,68 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package daemon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/manuel-koch/go-auto-wlan/automation"
+	"github.com/manuel-koch/go-auto-wlan/config"
+	"github.com/manuel-koch/go-auto-wlan/service"
+	"github.com/manuel-koch/go-auto-wlan/utils"
+)
+
+const daemonName = "Auto WLAN daemon"
+
+// Daemon runs the automation without user interface,
+// it's controlled by the config file and signals only.
+type Daemon struct {
+	serviceCtx    context.Context
+	serviceCancel func()
+	service       *service.Service
+	automation    *automation.Automation
+}
+
+func NewDaemon(versionInfo, versionsSha1, buildInfo string, backends service.Backends, cfg *config.Config, state *config.State, clock utils.Clock) *Daemon {
+	logger.Info(fmt.Sprintf("%s, version v%s (%s), built %s", daemonName, versionInfo, versionsSha1, buildInfo))
+	serviceCtx, serviceCancel := context.WithCancel(context.Background())
+	d := &Daemon{
+		serviceCtx:    serviceCtx,
+		serviceCancel: serviceCancel,
+		service:       service.NewService(serviceCtx, backends),
+	}
+	d.automation = automation.NewAutomation(d.service, cfg, state, clock, nil)
+	return d
+}
+
+// Run runs the automation until the daemon gets shut down.
+func (d *Daemon) Run() {
+	d.automation.Start(d.serviceCtx)
+	<-d.serviceCtx.Done()
+	logger.Info("Daemon stopped")
+}
+
+func (d *Daemon) Shutdown() {
+	logger.Info("Daemon shutdown")
+	d.serviceCancel()
+}
+
+// Reload replaces the config of the running automation.
+func (d *Daemon) Reload(cfg *config.Config) {
+	logger.Info("Daemon reloading config")
+	d.automation.SetConfig(cfg)
+}
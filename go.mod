@@ -23,14 +23,13 @@ require github.com/getlantern/systray v1.2.2
 
 require (
 	github.com/cratonica/2goarray v0.0.0-20190331194516-514510793eaa // indirect
-	github.com/godbus/dbus/v5 v5.0.4 // indirect
 	github.com/tevino/abool v1.2.0 // indirect
 	golang.org/x/crypto v0.16.0 // indirect
 	golang.org/x/term v0.15.0 // indirect
 )
 
 require (
-	fyne.io/systray v1.10.0
+	fyne.io/systray v1.11.0
 	github.com/getlantern/context v0.0.0-20190109183933-c447772a6520 // indirect
 	github.com/getlantern/errors v0.0.0-20190325191628-abdb3e3e36f7 // indirect
 	github.com/getlantern/golog v0.0.0-20190830074920-4ef2e798c2d7 // indirect
@@ -38,7 +37,9 @@ require (
 	github.com/getlantern/hidden v0.0.0-20190325191715-f02dbb02be55 // indirect
 	github.com/getlantern/ops v0.0.0-20190325191751-d70cb0d6f85f // indirect
 	github.com/go-stack/stack v1.8.0 // indirect
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c // indirect
 	github.com/sirupsen/logrus v1.9.3
 	golang.org/x/sys v0.15.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -18,12 +18,21 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
 	"syscall"
 
 	"github.com/manuel-koch/go-auto-wlan/app"
+	"github.com/manuel-koch/go-auto-wlan/cli"
+	"github.com/manuel-koch/go-auto-wlan/config"
+	"github.com/manuel-koch/go-auto-wlan/daemon"
 	"github.com/manuel-koch/go-auto-wlan/logging"
+	"github.com/manuel-koch/go-auto-wlan/service"
+	"github.com/manuel-koch/go-auto-wlan/simulation"
+	"github.com/manuel-koch/go-auto-wlan/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -33,18 +42,124 @@ var (
 	versionSha1 string
 	buildDate   string
 
-	logLevel string
-	logPath  string
+	logLevel       string
+	logPath        string
+	recordCommands string
+	replayCommands string
+	platform       string
+	simulate       string
+	configPath     string
 )
 
 func main() {
 	flag.StringVar(&logLevel, "log-level", "INFO", "Select the log level: DEBUG, INFO, WARN")
 	flag.StringVar(&logPath, "log-path", "", "Log to file at given path")
+	flag.StringVar(&recordCommands, "record-commands", "", "Record all system commands to file at given path")
+	flag.StringVar(&replayCommands, "replay-commands", "", "Replay system commands from recordings at given path")
+	flag.StringVar(&platform, "platform", runtime.GOOS, "Select the platform backends: darwin, linux")
+	flag.StringVar(&simulate, "simulate", "", "Simulate lid and WLAN using scenario from YAML file at given path")
+	flag.StringVar(&configPath, "config", "", "Load config from YAML file at given path instead of the user's config directory")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [subcommand]\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output())
+		cli.Usage(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "  daemon                     Run the automation without menu, SIGHUP reloads the config")
+	}
 	flag.Parse()
 
-	logging.ConfigueLogging(false, logLevel, logPath)
+	runDaemon := flag.NArg() > 0 && flag.Arg(0) == "daemon"
+	if runDaemon && flag.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Unexpected arguments for daemon")
+		os.Exit(cli.ExitUsage)
+	} else if flag.NArg() > 0 && !runDaemon {
+		os.Exit(runSubcommand(flag.Args()))
+	}
+
+	if len(configPath) == 0 {
+		defaultPath, err := config.DefaultPath()
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Failed to find config directory: %v", err))
+		}
+		configPath = defaultPath
+	}
+	// simulated and replayed systems must not change the real config and state,
+	// e.g. a simulated device switched off would get restored on the real system
+	var simulationDir string
+	if len(simulate) > 0 || len(replayCommands) > 0 {
+		dir, err := os.MkdirTemp("", "autowlan-")
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Failed to create simulation directory: %v", err))
+		}
+		defer os.RemoveAll(dir)
+		simulationDir = dir
+	}
+	loadConfig := func() (*config.Config, error) {
+		cfg, err := config.Load(configPath)
+		if err == nil && len(simulationDir) > 0 {
+			cfg.SetPath(filepath.Join(simulationDir, "config.yaml"))
+		}
+		return cfg, err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Failed to load config: %v", err))
+	}
+	statePath := config.StatePath(configPath)
+	if len(simulationDir) > 0 {
+		statePath = filepath.Join(simulationDir, "state.yaml")
+	}
+	state, err := config.LoadState(statePath)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Failed to load state: %v", err))
+	}
+
+	// log options from config unless given on command line
+	flagsSet := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { flagsSet[f.Name] = true })
+	if !flagsSet["log-level"] && len(cfg.Log.Level) > 0 {
+		logLevel = cfg.Log.Level
+	}
+	if !flagsSet["log-path"] {
+		logPath = cfg.Log.Path
+	}
+	logging.ConfigueLogging(cfg.Log.JSON, logLevel, logPath)
+	if len(simulationDir) > 0 {
+		log.Info(fmt.Sprintf("Keeping config changes and state in %s", simulationDir))
+	}
+
+	cfg.ApplyIntervals()
+
+	backends, closeBackends := newBackends()
+	defer closeBackends()
+
+	if runDaemon {
+		d := daemon.NewDaemon(versionTag, versionSha1, buildDate, backends, cfg, state, utils.RealClock{})
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		go func() {
+			for sig := range sigs {
+				if sig != syscall.SIGHUP {
+					log.Info("Received shutdown signal")
+					d.Shutdown()
+					return
+				}
+				log.Info("Received reload signal")
+				if reloaded, err := loadConfig(); err != nil {
+					log.Error(fmt.Sprintf("Failed to reload config, keeping current one: %v", err))
+				} else {
+					d.Reload(reloaded)
+				}
+			}
+		}()
+
+		d.Run()
+		return
+	}
 
-	app := app.NewApp(versionTag, versionSha1, buildDate)
+	app := app.NewApp(versionTag, versionSha1, buildDate, backends, cfg, state, utils.RealClock{})
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
@@ -56,3 +171,60 @@ func main() {
 
 	app.Run()
 }
+
+// newBackends returns the backends selected by command line flags,
+// the returned function must be called when done with them.
+func newBackends() (service.Backends, func()) {
+	closeBackends := func() {}
+
+	var runner service.CommandRunner = service.ExecCommandRunner{}
+	if len(replayCommands) > 0 {
+		replayRunner, err := service.NewReplayCommandRunner(replayCommands)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Failed to load command recordings: %v", err))
+		}
+		runner = replayRunner
+	} else if len(recordCommands) > 0 {
+		recordingRunner, err := service.NewRecordingCommandRunner(recordCommands)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Failed to create command recordings: %v", err))
+		}
+		closeBackends = func() { recordingRunner.Close() }
+		runner = recordingRunner
+	}
+
+	backends := service.NewPlatformBackends(platform, runner)
+	if len(simulate) > 0 {
+		scenario, err := simulation.LoadScenario(simulate)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Failed to load simulation scenario: %v", err))
+		}
+		log.Info(fmt.Sprintf("Simulating scenario %s", simulate))
+		backends = simulation.NewSimulator(scenario, utils.RealClock{}).Backends()
+	}
+	return backends, closeBackends
+}
+
+// runSubcommand runs the command line subcommand given by args, returns the exit code.
+func runSubcommand(args []string) int {
+	if !cli.IsSubcommand(args[0]) {
+		fmt.Fprintf(os.Stderr, "Unknown subcommand '%s'\n", args[0])
+		flag.Usage()
+		return cli.ExitUsage
+	}
+
+	// only warnings by default, logging to stderr to keep stdout for the output
+	isLogLevelSet := false
+	flag.Visit(func(f *flag.Flag) { isLogLevelSet = isLogLevelSet || f.Name == "log-level" })
+	if !isLogLevelSet {
+		logLevel = "WARN"
+	}
+	logging.ConfigueLogging(false, logLevel, logPath)
+	if len(logPath) == 0 {
+		log.SetOutput(os.Stderr)
+	}
+
+	backends, closeBackends := newBackends()
+	defer closeBackends()
+	return cli.NewCLI(backends, os.Stdout, os.Stderr).Run(args)
+}
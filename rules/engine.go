@@ -0,0 +1,184 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package rules
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/service"
+	"github.com/manuel-koch/go-auto-wlan/utils"
+)
+
+// EvaluateInterval re-evaluates the rules without service events,
+// so time of day conditions take effect.
+const EvaluateInterval = time.Minute
+
+// State is the snapshot of the service state rules are evaluated against.
+type State struct {
+	LidState        service.LidState
+	WlanDevices     []service.WlanDevice
+	PowerState      service.PowerState
+	EthernetDevices []service.EthernetDevice
+}
+
+// Controller is the part of the service the engine queries state from and acts on.
+type Controller interface {
+	GetLidState() service.LidState
+	GetWlanDevices() []service.WlanDevice
+	GetPowerState() service.PowerState
+	GetEthernetDevices() []service.EthernetDevice
+	SetWlanState(device string, state service.WlanState)
+	SetBluetoothState(state service.BluetoothState)
+	Notify(title, message string)
+}
+
+// Engine evaluates rules on every service event and runs the actions
+// of rules whose conditions became true.
+// Rules already matching when the engine starts don't run their actions.
+type Engine struct {
+	rules      []Rule
+	controller Controller
+	clock      utils.Clock
+
+	matched []bool
+	pending [][]utils.Timer
+}
+
+func NewEngine(rules []Rule, controller Controller, clock utils.Clock) *Engine {
+	return &Engine{
+		rules:      rules,
+		controller: controller,
+		clock:      clock,
+		matched:    make([]bool, len(rules)),
+		pending:    make([][]utils.Timer, len(rules)),
+	}
+}
+
+// Run evaluates the rules for each of given service events until the context is done.
+func (e *Engine) Run(ctx context.Context, events <-chan interface{}) {
+	logger.Info(fmt.Sprintf("Starting rules engine with %d rules", len(e.rules)))
+	state := e.queryState()
+	for i := range e.rules {
+		e.matched[i] = e.rules[i].When.matches(state, e.clock.Now())
+	}
+
+	for {
+		evaluateDue := make(chan interface{})
+		evaluateTimer := e.clock.AfterFunc(EvaluateInterval, func() { close(evaluateDue) })
+		select {
+		case <-ctx.Done():
+			evaluateTimer.Stop()
+			for i := range e.rules {
+				e.cancelPending(i)
+			}
+			logger.Info("Stopped rules engine")
+			return
+		case _, ok := <-events:
+			evaluateTimer.Stop()
+			if !ok {
+				return
+			}
+			e.evaluate()
+		case <-evaluateDue:
+			e.evaluate()
+		}
+	}
+}
+
+func (e *Engine) queryState() State {
+	return State{
+		LidState:        e.controller.GetLidState(),
+		WlanDevices:     e.controller.GetWlanDevices(),
+		PowerState:      e.controller.GetPowerState(),
+		EthernetDevices: e.controller.GetEthernetDevices(),
+	}
+}
+
+func (e *Engine) evaluate() {
+	state := e.queryState()
+	now := e.clock.Now()
+	for i := range e.rules {
+		rule := &e.rules[i]
+		matched := rule.When.matches(state, now)
+		if matched == e.matched[i] {
+			continue
+		}
+		e.matched[i] = matched
+		if !matched {
+			if len(e.pending[i]) > 0 {
+				logger.Info(fmt.Sprintf("Rule '%s' no longer matches, cancelling pending actions", rule.String()))
+			}
+			e.cancelPending(i)
+			continue
+		}
+		logger.Info(fmt.Sprintf("Rule '%s' matches", rule.String()))
+		for _, action := range rule.Actions {
+			if action.Delay > 0 {
+				logger.Info(fmt.Sprintf("Rule '%s' runs action in %s", rule.String(), action.Delay))
+				action := action
+				e.pending[i] = append(e.pending[i], e.clock.AfterFunc(action.Delay, func() {
+					e.runAction(rule, action)
+				}))
+			} else {
+				e.runAction(rule, action)
+			}
+		}
+	}
+}
+
+func (e *Engine) cancelPending(i int) {
+	for _, timer := range e.pending[i] {
+		timer.Stop()
+	}
+	e.pending[i] = nil
+}
+
+func (e *Engine) runAction(rule *Rule, action Action) {
+	if len(action.Notify) > 0 {
+		e.controller.Notify(rule.String(), action.Notify)
+	}
+	if len(action.Power) == 0 {
+		return
+	}
+	on, _ := parsePower(action.Power)
+	switch action.Device {
+	case BluetoothDevice:
+		if on {
+			e.controller.SetBluetoothState(service.BluetoothPowerOn)
+		} else {
+			e.controller.SetBluetoothState(service.BluetoothPowerOff)
+		}
+	case AllDevices:
+		for _, device := range e.controller.GetWlanDevices() {
+			if device.State != service.WlanHardBlocked {
+				e.setWlanState(device.Name, on)
+			}
+		}
+	default:
+		e.setWlanState(action.Device, on)
+	}
+}
+
+func (e *Engine) setWlanState(device string, on bool) {
+	if on {
+		e.controller.SetWlanState(device, service.WlanPowerOn)
+	} else {
+		e.controller.SetWlanState(device, service.WlanPowerOff)
+	}
+}
@@ -0,0 +1,185 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package rules
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/service"
+	"github.com/manuel-koch/go-auto-wlan/utils/clocktest"
+)
+
+// fakeController keeps the state rules are evaluated against and records the actions run.
+type fakeController struct {
+	mutex       sync.Mutex
+	lidState    service.LidState
+	wlanDevices []service.WlanDevice
+	switched    []string
+	notified    []string
+}
+
+func (c *fakeController) GetLidState() service.LidState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lidState
+}
+
+func (c *fakeController) GetWlanDevices() []service.WlanDevice {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.wlanDevices
+}
+
+func (c *fakeController) GetPowerState() service.PowerState {
+	return service.PowerState{Source: service.PowerSourceBattery, Percentage: 50}
+}
+
+func (c *fakeController) GetEthernetDevices() []service.EthernetDevice {
+	return nil
+}
+
+func (c *fakeController) SetWlanState(device string, state service.WlanState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.switched = append(c.switched, device+" "+service.WlanStateToString(state))
+}
+
+func (c *fakeController) SetBluetoothState(state service.BluetoothState) {}
+
+func (c *fakeController) Notify(title, message string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.notified = append(c.notified, message)
+}
+
+func (c *fakeController) setLidState(lidState service.LidState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lidState = lidState
+}
+
+func (c *fakeController) actions() ([]string, []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]string{}, c.switched...), append([]string{}, c.notified...)
+}
+
+// startTestEngine runs an engine notifying when the lid closed and switching all devices off 30s later,
+// returns the channel to send events to.
+func startTestEngine(t *testing.T, controller *fakeController, clock *clocktest.FakeClock) chan interface{} {
+	t.Helper()
+	rule := Rule{
+		Name: "Offline when closed",
+		When: Condition{Lid: "closed"},
+		Actions: []Action{
+			{Notify: "Lid closed"},
+			{Device: AllDevices, Power: "off", Delay: 30 * time.Second},
+		},
+	}
+	if err := rule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan interface{})
+	done := make(chan interface{})
+	go func() {
+		NewEngine([]Rule{rule}, controller, clock).Run(ctx, events)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	// rules already matching at start are ignored, wait for the engine to know the initial state
+	sendEvent(events)
+	return events
+}
+
+// sendEvent lets the engine evaluate the rules,
+// the second send only completes once the first event got evaluated.
+func sendEvent(events chan interface{}) {
+	events <- true
+	events <- true
+}
+
+func TestEngineRunsDelayedAction(t *testing.T) {
+	controller := &fakeController{
+		lidState:    service.LidOpen,
+		wlanDevices: []service.WlanDevice{{Name: "en0", State: service.WlanPowerOn}, {Name: "en1", State: service.WlanHardBlocked}},
+	}
+	clock := clocktest.NewFakeClock(time.Date(2023, 6, 1, 12, 0, 0, 0, time.Local))
+	events := startTestEngine(t, controller, clock)
+
+	controller.setLidState(service.LidClosed)
+	sendEvent(events)
+	switched, notified := controller.actions()
+	if len(notified) != 1 || len(switched) != 0 {
+		t.Fatalf("after lid closed switched %v and notified %v, want only a notification", switched, notified)
+	}
+
+	clock.Advance(29 * time.Second)
+	if switched, _ := controller.actions(); len(switched) != 0 {
+		t.Fatalf("switched %v before delay", switched)
+	}
+	clock.Advance(time.Second)
+	if switched, _ := controller.actions(); len(switched) != 1 || switched[0] != "en0 off" {
+		t.Errorf("switched %v after delay, want en0 off", switched)
+	}
+}
+
+func TestEngineCancelsDelayedAction(t *testing.T) {
+	controller := &fakeController{
+		lidState:    service.LidOpen,
+		wlanDevices: []service.WlanDevice{{Name: "en0", State: service.WlanPowerOn}},
+	}
+	clock := clocktest.NewFakeClock(time.Date(2023, 6, 1, 12, 0, 0, 0, time.Local))
+	events := startTestEngine(t, controller, clock)
+
+	controller.setLidState(service.LidClosed)
+	sendEvent(events)
+	clock.Advance(10 * time.Second)
+	controller.setLidState(service.LidOpen)
+	sendEvent(events)
+	clock.Advance(time.Minute)
+
+	if switched, _ := controller.actions(); len(switched) != 0 {
+		t.Errorf("switched %v after rule stopped matching", switched)
+	}
+}
+
+func TestEngineEvaluatesWithoutEvents(t *testing.T) {
+	controller := &fakeController{lidState: service.LidOpen}
+	clock := clocktest.NewFakeClock(time.Date(2023, 6, 1, 12, 0, 0, 0, time.Local))
+	startTestEngine(t, controller, clock)
+
+	controller.setLidState(service.LidClosed)
+	clock.Advance(EvaluateInterval)
+	// wait for the evaluation triggered by the clock
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, notified := controller.actions(); len(notified) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rules not evaluated after %s", EvaluateInterval)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
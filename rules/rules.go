@@ -0,0 +1,223 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/service"
+)
+
+// AllDevices selects every WLAN device in an action.
+const AllDevices = "all"
+
+// BluetoothDevice selects the Bluetooth radio in an action.
+const BluetoothDevice = "bluetooth"
+
+// Rule runs its actions once all of its conditions become true.
+type Rule struct {
+	Name    string    `yaml:"name,omitempty"`
+	When    Condition `yaml:"when"`
+	Actions []Action  `yaml:"actions"`
+}
+
+// Condition of a rule, empty values match any state.
+type Condition struct {
+	// Lid is "open" or "closed".
+	Lid string `yaml:"lid,omitempty"`
+	// Networks matches when any WLAN device is connected to one of the SSIDs.
+	Networks []string `yaml:"networks,omitempty"`
+	// Power is "ac" or "battery".
+	Power string `yaml:"power,omitempty"`
+	// Time is a range of local time of day, e.g. "22:00-06:00".
+	Time string `yaml:"time,omitempty"`
+	// Ethernet is "up" when any wired link is up, or "down".
+	Ethernet string `yaml:"ethernet,omitempty"`
+}
+
+// Action of a rule, either switching a radio or showing a notification.
+type Action struct {
+	// Device is the name of a WLAN device, "all" or "bluetooth".
+	Device string `yaml:"device,omitempty"`
+	// Power is "on" or "off".
+	Power string `yaml:"power,omitempty"`
+	// Delay postpones the action, it is cancelled when the rule no longer matches.
+	Delay time.Duration `yaml:"delay,omitempty"`
+	// Notify shows given message.
+	Notify string `yaml:"notify,omitempty"`
+}
+
+// timeRange is a range of time of day in minutes since midnight.
+type timeRange struct {
+	from int
+	to   int
+}
+
+// Validate returns an error for invalid conditions or actions.
+func (r *Rule) Validate() error {
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("rule '%s' without actions", r.Name)
+	}
+	if _, err := parseLidState(r.When.Lid); err != nil {
+		return err
+	}
+	if _, err := parsePowerSource(r.When.Power); err != nil {
+		return err
+	}
+	if _, err := parseEthernetLink(r.When.Ethernet); err != nil {
+		return err
+	}
+	if _, err := parseTimeRange(r.When.Time); err != nil {
+		return err
+	}
+	for _, action := range r.Actions {
+		if len(action.Notify) > 0 && len(action.Power) == 0 {
+			continue
+		}
+		if len(action.Device) == 0 {
+			return fmt.Errorf("rule '%s': action without device", r.Name)
+		}
+		if _, err := parsePower(action.Power); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String returns the name of the rule, or a generated one for unnamed rules.
+func (r *Rule) String() string {
+	if len(r.Name) > 0 {
+		return r.Name
+	}
+	return fmt.Sprintf("%+v", r.When)
+}
+
+// matches returns whether all conditions are true for given state.
+func (c *Condition) matches(state State, now time.Time) bool {
+	if lidState, _ := parseLidState(c.Lid); lidState != service.LidUnknown && lidState != state.LidState {
+		return false
+	}
+	if powerSource, _ := parsePowerSource(c.Power); powerSource != service.PowerSourceUnknown && powerSource != state.PowerState.Source {
+		return false
+	}
+	if ethernet, _ := parseEthernetLink(c.Ethernet); ethernet != service.EthernetUnknown {
+		if (ethernet == service.EthernetLinkUp) != service.AnyEthernetLinkUp(state.EthernetDevices) {
+			return false
+		}
+	}
+	if len(c.Networks) > 0 && !anyConnectedTo(state.WlanDevices, c.Networks) {
+		return false
+	}
+	if timeRange, _ := parseTimeRange(c.Time); timeRange != nil && !timeRange.contains(now) {
+		return false
+	}
+	return true
+}
+
+func anyConnectedTo(devices []service.WlanDevice, networks []string) bool {
+	for _, device := range devices {
+		for _, network := range networks {
+			if len(device.Network) > 0 && device.Network == network {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t *timeRange) contains(now time.Time) bool {
+	minutes := now.Hour()*60 + now.Minute()
+	if t.from <= t.to {
+		return minutes >= t.from && minutes < t.to
+	}
+	// range wraps around midnight
+	return minutes >= t.from || minutes < t.to
+}
+
+func parseLidState(value string) (service.LidState, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return service.LidUnknown, nil
+	case "open":
+		return service.LidOpen, nil
+	case "closed":
+		return service.LidClosed, nil
+	default:
+		return service.LidUnknown, fmt.Errorf("invalid lid state '%s', use 'open' or 'closed'", value)
+	}
+}
+
+func parsePowerSource(value string) (service.PowerSource, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return service.PowerSourceUnknown, nil
+	case "ac":
+		return service.PowerSourceAC, nil
+	case "battery":
+		return service.PowerSourceBattery, nil
+	default:
+		return service.PowerSourceUnknown, fmt.Errorf("invalid power source '%s', use 'ac' or 'battery'", value)
+	}
+}
+
+func parseEthernetLink(value string) (service.EthernetLinkState, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return service.EthernetUnknown, nil
+	case "up":
+		return service.EthernetLinkUp, nil
+	case "down":
+		return service.EthernetLinkDown, nil
+	default:
+		return service.EthernetUnknown, fmt.Errorf("invalid ethernet link '%s', use 'up' or 'down'", value)
+	}
+}
+
+func parsePower(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid power '%s', use 'on' or 'off'", value)
+	}
+}
+
+func parseTimeRange(value string) (*timeRange, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+	from, to, found := strings.Cut(value, "-")
+	if !found {
+		return nil, fmt.Errorf("invalid time range '%s', use e.g. '22:00-06:00'", value)
+	}
+	fromTime, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("invalid time range '%s': %v", value, err)
+	}
+	toTime, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return nil, fmt.Errorf("invalid time range '%s': %v", value, err)
+	}
+	return &timeRange{
+		from: fromTime.Hour()*60 + fromTime.Minute(),
+		to:   toTime.Hour()*60 + toTime.Minute(),
+	}, nil
+}
@@ -0,0 +1,48 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+// Backends bundles the platform specific probes used by the service.
+// Optional backends may be nil, a missing sleep event source
+// is replaced by detecting wake from time gaps.
+type Backends struct {
+	Wlan       WlanBackend
+	WlanEvents WlanEventSource
+	Lid        LidSensor
+	LidEvents  LidEventSource
+	Bluetooth  BluetoothBackend
+	Ethernet   EthernetBackend
+	Power      PowerSourceBackend
+	Sleep      SleepEventSource
+	Notifier   Notifier
+}
+
+// NewPlatformBackends returns the backends for named platform, e.g. "darwin" or "linux",
+// running external commands with given runner.
+func NewPlatformBackends(platform string, runner CommandRunner) Backends {
+	return Backends{
+		Wlan:       NewPlatformWlanBackend(platform, runner),
+		WlanEvents: NewPlatformWlanEventSource(platform),
+		Lid:        NewPlatformLidSensor(platform, runner),
+		LidEvents:  NewPlatformLidEventSource(platform),
+		Bluetooth:  NewPlatformBluetoothBackend(platform, runner),
+		Ethernet:   NewPlatformEthernetBackend(platform, runner),
+		Power:      NewPlatformPowerSourceBackend(platform, runner),
+		Sleep:      NewPlatformSleepEventSource(platform),
+		Notifier:   NewPlatformNotifier(platform, runner),
+	}
+}
@@ -0,0 +1,80 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+type BluetoothState int
+
+const (
+	BluetoothUnknown  BluetoothState = iota
+	BluetoothPowerOn  BluetoothState = iota
+	BluetoothPowerOff BluetoothState = iota
+)
+
+// BluetoothBackend abstracts the platform specific way
+// to query and control the Bluetooth radio.
+type BluetoothBackend interface {
+	// GetBluetoothState returns the power state of the Bluetooth radio.
+	GetBluetoothState() (BluetoothState, error)
+	// SetBluetoothState switches the power of the Bluetooth radio.
+	SetBluetoothState(state BluetoothState) error
+}
+
+// NewPlatformBluetoothBackend returns the Bluetooth backend for named platform, e.g. "darwin" or "linux".
+// Returns nil when the required tools are not installed.
+func NewPlatformBluetoothBackend(platform string, runner CommandRunner) BluetoothBackend {
+	switch platform {
+	case "linux":
+		if _, err := exec.LookPath("bluetoothctl"); err == nil {
+			return NewBluetoothctlBluetoothBackend(runner)
+		}
+		return NewRfkillBluetoothBackend("/")
+	default:
+		if !runsOnSystem(runner) {
+			// the replayed commands stand in for blueutil
+			return NewBlueutilBluetoothBackend(runner)
+		}
+		if _, err := exec.LookPath("blueutil"); err != nil {
+			logger.Info("Bluetooth automation requires blueutil, see https://github.com/toy/blueutil")
+			return nil
+		}
+		return NewBlueutilBluetoothBackend(runner)
+	}
+}
+
+type InvalidBluetoothStateError struct {
+	state BluetoothState
+}
+
+func (e InvalidBluetoothStateError) Error() string {
+	return fmt.Sprintf("Invalid bluetooth state: %d (%s)", e.state, BluetoothStateToString(e.state))
+}
+
+func BluetoothStateToString(state BluetoothState) string {
+	switch state {
+	case BluetoothPowerOn:
+		return "on"
+	case BluetoothPowerOff:
+		return "off"
+	default:
+		return "unknown"
+	}
+}
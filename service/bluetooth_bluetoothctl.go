@@ -0,0 +1,74 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/manuel-koch/go-auto-wlan/utils"
+)
+
+// BluetoothctlBluetoothBackend controls the Bluetooth radio on Linux
+// using the BlueZ command line client "bluetoothctl".
+type BluetoothctlBluetoothBackend struct {
+	runner CommandRunner
+}
+
+func NewBluetoothctlBluetoothBackend(runner CommandRunner) *BluetoothctlBluetoothBackend {
+	return &BluetoothctlBluetoothBackend{runner: runner}
+}
+
+func (b *BluetoothctlBluetoothBackend) GetBluetoothState() (BluetoothState, error) {
+	if output, err := b.runner.Output("bluetoothctl", "show"); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get bluetooth controller: %v", err))
+		return BluetoothUnknown, err
+	} else {
+		poweredRe := regexp.MustCompile("^\\s*Powered:\\s+(?P<powered>\\S+)")
+		lines := strings.Split(string(output), "\n")
+		for _, line := range lines {
+			poweredMatch := utils.MatchNamedExpression(poweredRe, line)
+			if poweredMatch != nil {
+				switch strings.ToLower(poweredMatch["powered"]) {
+				case "yes":
+					return BluetoothPowerOn, nil
+				case "no":
+					return BluetoothPowerOff, nil
+				}
+			}
+		}
+		return BluetoothUnknown, nil
+	}
+}
+
+func (b *BluetoothctlBluetoothBackend) SetBluetoothState(state BluetoothState) error {
+	var power string
+	switch state {
+	case BluetoothPowerOn:
+		power = "on"
+	case BluetoothPowerOff:
+		power = "off"
+	default:
+		return InvalidBluetoothStateError{state: state}
+	}
+	if _, err := b.runner.Output("bluetoothctl", "power", power); err != nil {
+		logger.Error(fmt.Sprintf("Failed to set bluetooth power: %v", err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BlueutilBluetoothBackend controls the Bluetooth radio on MacOS
+// using the "blueutil" command.
+type BlueutilBluetoothBackend struct {
+	runner CommandRunner
+}
+
+func NewBlueutilBluetoothBackend(runner CommandRunner) *BlueutilBluetoothBackend {
+	return &BlueutilBluetoothBackend{runner: runner}
+}
+
+func (b *BlueutilBluetoothBackend) GetBluetoothState() (BluetoothState, error) {
+	if output, err := b.runner.Output("blueutil", "--power"); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get bluetooth power: %v", err))
+		return BluetoothUnknown, err
+	} else {
+		switch strings.TrimSpace(string(output)) {
+		case "1":
+			return BluetoothPowerOn, nil
+		case "0":
+			return BluetoothPowerOff, nil
+		}
+		return BluetoothUnknown, nil
+	}
+}
+
+func (b *BlueutilBluetoothBackend) SetBluetoothState(state BluetoothState) error {
+	var power string
+	switch state {
+	case BluetoothPowerOn:
+		power = "1"
+	case BluetoothPowerOff:
+		power = "0"
+	default:
+		return InvalidBluetoothStateError{state: state}
+	}
+	if _, err := b.runner.Output("blueutil", "--power", power); err != nil {
+		logger.Error(fmt.Sprintf("Failed to set bluetooth power: %v", err))
+		return err
+	}
+	return nil
+}
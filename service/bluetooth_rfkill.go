@@ -0,0 +1,87 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import "fmt"
+
+// RfkillBluetoothBackend controls the Bluetooth radios on Linux
+// using the rfkill switches in "/sys/class/rfkill".
+// A radio blocked by hardware switch is reported as powered off.
+type RfkillBluetoothBackend struct {
+	root string
+}
+
+// NewRfkillBluetoothBackend returns a Bluetooth backend using sysfs below given root path,
+// which is "/" for the real system.
+func NewRfkillBluetoothBackend(root string) *RfkillBluetoothBackend {
+	return &RfkillBluetoothBackend{root: root}
+}
+
+func (b *RfkillBluetoothBackend) GetBluetoothState() (BluetoothState, error) {
+	switches, err := findRfkillSwitches(b.root, "bluetooth")
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get rfkill switches: %v", err))
+		return BluetoothUnknown, err
+	}
+	if len(switches) == 0 {
+		return BluetoothUnknown, nil
+	}
+	for _, sw := range switches {
+		if state, err := sw.bluetoothState(); err == nil && state == BluetoothPowerOn {
+			return BluetoothPowerOn, nil
+		}
+	}
+	return BluetoothPowerOff, nil
+}
+
+func (b *RfkillBluetoothBackend) SetBluetoothState(state BluetoothState) error {
+	var soft bool
+	switch state {
+	case BluetoothPowerOn:
+		soft = false
+	case BluetoothPowerOff:
+		soft = true
+	default:
+		return InvalidBluetoothStateError{state: state}
+	}
+	switches, err := findRfkillSwitches(b.root, "bluetooth")
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get rfkill switches: %v", err))
+		return err
+	}
+	for _, sw := range switches {
+		if err := sw.setSoftBlock(soft); err != nil {
+			logger.Error(fmt.Sprintf("Failed to set rfkill state: %v", err))
+			return err
+		}
+	}
+	return nil
+}
+
+// bluetoothState maps the block state of the switch to the state of a Bluetooth radio,
+// a radio blocked by software or hardware switch is powered off.
+func (s rfkillSwitch) bluetoothState() (BluetoothState, error) {
+	soft, hard, err := s.blocked()
+	switch {
+	case err != nil:
+		return BluetoothUnknown, err
+	case soft || hard:
+		return BluetoothPowerOff, nil
+	default:
+		return BluetoothPowerOn, nil
+	}
+}
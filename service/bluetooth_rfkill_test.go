@@ -0,0 +1,52 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import "testing"
+
+func TestRfkillBluetoothBackendGetBluetoothState(t *testing.T) {
+	tests := []struct {
+		name     string
+		switches []fakeRfkillSwitch
+		want     BluetoothState
+	}{
+		{name: "none", want: BluetoothUnknown},
+		{name: "unblocked", switches: []fakeRfkillSwitch{{name: "rfkill0", kind: "bluetooth", soft: "0", hard: "0"}}, want: BluetoothPowerOn},
+		{name: "soft blocked", switches: []fakeRfkillSwitch{{name: "rfkill0", kind: "bluetooth", soft: "1", hard: "0"}}, want: BluetoothPowerOff},
+		{name: "hard blocked", switches: []fakeRfkillSwitch{{name: "rfkill0", kind: "bluetooth", soft: "0", hard: "1"}}, want: BluetoothPowerOff},
+		{name: "wlan ignored", switches: []fakeRfkillSwitch{{name: "rfkill0", kind: "wlan", soft: "0", hard: "0"}}, want: BluetoothUnknown},
+		{
+			name: "any unblocked",
+			switches: []fakeRfkillSwitch{
+				{name: "rfkill0", kind: "bluetooth", soft: "1", hard: "0"},
+				{name: "rfkill1", kind: "bluetooth", soft: "0", hard: "0"},
+			},
+			want: BluetoothPowerOn,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewRfkillBluetoothBackend(writeFakeRfkill(t, tt.switches)).GetBluetoothState()
+			if err != nil {
+				t.Fatalf("GetBluetoothState() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetBluetoothState() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlatformBluetoothBackendReplaysWithoutBlueutil(t *testing.T) {
+	// neither blueutil nor any other tool can be found
+	t.Setenv("PATH", t.TempDir())
+
+	if backend := NewPlatformBluetoothBackend("darwin", ExecCommandRunner{}); backend != nil {
+		t.Errorf("NewPlatformBluetoothBackend() without blueutil = %T, want nil", backend)
+	}
+
+	path := filepath.Join(t.TempDir(), "commands.jsonl")
+	if err := os.WriteFile(path, []byte(`{"argv":["blueutil","--power"],"stdout":"1\n","stderr":"","exit_code":0}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	replayer, err := NewReplayCommandRunner(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := NewPlatformBluetoothBackend("darwin", replayer)
+	if backend == nil {
+		t.Fatalf("NewPlatformBluetoothBackend() replaying blueutil = nil")
+	}
+	if state, err := backend.GetBluetoothState(); err != nil || state != BluetoothPowerOn {
+		t.Errorf("GetBluetoothState() = %v, %v, want on", state, err)
+	}
+}
@@ -0,0 +1,86 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import "fmt"
+
+type EthernetLinkState int
+
+const (
+	EthernetUnknown  EthernetLinkState = iota
+	EthernetLinkUp   EthernetLinkState = iota
+	EthernetLinkDown EthernetLinkState = iota
+)
+
+// EthernetDevice is a wired network device, e.g. Ethernet or Thunderbolt.
+type EthernetDevice struct {
+	Name string
+	Port string
+	Link EthernetLinkState
+}
+
+// EthernetBackend abstracts the platform specific way
+// to query wired network devices.
+type EthernetBackend interface {
+	// GetEthernetDevices returns all wired network devices including their link state.
+	GetEthernetDevices() ([]EthernetDevice, error)
+}
+
+// NewPlatformEthernetBackend returns the Ethernet backend for named platform, e.g. "darwin" or "linux".
+func NewPlatformEthernetBackend(platform string, runner CommandRunner) EthernetBackend {
+	switch platform {
+	case "linux":
+		return NewSysfsEthernetBackend("/")
+	default:
+		return NewNetworksetupEthernetBackend(runner)
+	}
+}
+
+func (d *EthernetDevice) String() string {
+	s := fmt.Sprintf("%s is %s", d.Name, EthernetLinkStateToString(d.Link))
+	if len(d.Port) > 0 {
+		s += fmt.Sprintf(" (%s)", d.Port)
+	}
+	return s
+}
+
+func EthernetLinkStateToString(state EthernetLinkState) string {
+	switch state {
+	case EthernetLinkUp:
+		return "up"
+	case EthernetLinkDown:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
+func CopyEthernetDevices(devices []EthernetDevice) []EthernetDevice {
+	copyDevices := make([]EthernetDevice, len(devices))
+	copy(copyDevices, devices)
+	return copyDevices
+}
+
+// AnyEthernetLinkUp returns whether any of given devices has an active link.
+func AnyEthernetLinkUp(devices []EthernetDevice) bool {
+	for _, device := range devices {
+		if device.Link == EthernetLinkUp {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/manuel-koch/go-auto-wlan/utils"
+)
+
+// NetworksetupEthernetBackend queries wired network devices on MacOS
+// using the "networksetup" and "ifconfig" commands.
+type NetworksetupEthernetBackend struct {
+	runner CommandRunner
+}
+
+// wiredPortRe matches the names of wired hardware ports,
+// e.g. "Ethernet", "USB 10/100/1000 LAN" or "Thunderbolt Ethernet Slot 1".
+var wiredPortRe = regexp.MustCompile("(?i)ethernet|thunderbolt|\\bLAN\\b")
+
+func NewNetworksetupEthernetBackend(runner CommandRunner) *NetworksetupEthernetBackend {
+	return &NetworksetupEthernetBackend{runner: runner}
+}
+
+func (b *NetworksetupEthernetBackend) GetEthernetDevices() ([]EthernetDevice, error) {
+	logger.Debug("Searching ethernet devices...")
+
+	devices := make([]EthernetDevice, 0)
+
+	if ports, err := listHardwarePorts(b.runner); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get network hardware ports: %v", err))
+		return devices, err
+	} else {
+		for _, port := range ports {
+			if wlanPortRe.MatchString(port.port) || !wiredPortRe.MatchString(port.port) {
+				continue
+			}
+			if link, err := b.getLinkState(port.device); err == nil {
+				device := EthernetDevice{Name: port.device, Port: port.port, Link: link}
+				devices = append(devices, device)
+				logger.Debug(fmt.Sprintf("Found ethernet device %s", device.String()))
+			}
+		}
+	}
+
+	return devices, nil
+}
+
+func (b *NetworksetupEthernetBackend) getLinkState(device string) (EthernetLinkState, error) {
+	if output, err := b.runner.Output("ifconfig", device); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get interface config: %v", err))
+		return EthernetUnknown, err
+	} else {
+		statusRe := regexp.MustCompile("^\\s*status:\\s+(?P<status>\\S+)")
+		lines := strings.Split(string(output), "\n")
+		for _, line := range lines {
+			statusMatch := utils.MatchNamedExpression(statusRe, line)
+			if statusMatch != nil {
+				switch strings.ToLower(statusMatch["status"]) {
+				case "active":
+					return EthernetLinkUp, nil
+				case "inactive":
+					return EthernetLinkDown, nil
+				}
+			}
+		}
+		return EthernetUnknown, nil
+	}
+}
@@ -0,0 +1,74 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SysfsEthernetBackend queries wired network devices on Linux
+// using "/sys/class/net".
+type SysfsEthernetBackend struct {
+	root string
+}
+
+// NewSysfsEthernetBackend returns an Ethernet backend using sysfs below given root path,
+// which is "/" for the real system.
+func NewSysfsEthernetBackend(root string) *SysfsEthernetBackend {
+	return &SysfsEthernetBackend{root: root}
+}
+
+func (b *SysfsEthernetBackend) GetEthernetDevices() ([]EthernetDevice, error) {
+	logger.Debug("Searching ethernet devices...")
+
+	devices := make([]EthernetDevice, 0)
+
+	paths, err := filepath.Glob(filepath.Join(b.root, "sys", "class", "net", "*"))
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get network devices: %v", err))
+		return devices, err
+	}
+	for _, path := range paths {
+		// only physical devices of type ARPHRD_ETHER, skipping wireless ones
+		if _, err := os.Stat(filepath.Join(path, "device")); err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(path, "wireless")); err == nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(path, "phy80211")); err == nil {
+			continue
+		}
+		if kind, err := readSysfsValue(filepath.Join(path, "type")); err != nil || kind != "1" {
+			continue
+		}
+
+		device := EthernetDevice{Name: filepath.Base(path), Link: EthernetUnknown}
+		// reading the carrier fails while the interface is down
+		if carrier, err := readSysfsValue(filepath.Join(path, "carrier")); err != nil || carrier != "1" {
+			device.Link = EthernetLinkDown
+		} else {
+			device.Link = EthernetLinkUp
+		}
+		devices = append(devices, device)
+		logger.Debug(fmt.Sprintf("Found ethernet device %s", device.String()))
+	}
+
+	return devices, nil
+}
@@ -0,0 +1,179 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestAnyEthernetLinkUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		devices []EthernetDevice
+		want    bool
+	}{
+		{"no devices", nil, false},
+		{"all down", []EthernetDevice{{Name: "eth0", Link: EthernetLinkDown}, {Name: "eth1", Link: EthernetUnknown}}, false},
+		{"one up", []EthernetDevice{{Name: "eth0", Link: EthernetLinkDown}, {Name: "eth1", Link: EthernetLinkUp}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AnyEthernetLinkUp(tt.devices); got != tt.want {
+				t.Errorf("AnyEthernetLinkUp() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSysfsEthernetDevices(t *testing.T) {
+	root := t.TempDir()
+	// wired device with link
+	writeFakeFile(t, root, "sys/class/net/eth0/device/uevent", "DRIVER=e1000e\n")
+	writeFakeFile(t, root, "sys/class/net/eth0/type", "1\n")
+	writeFakeFile(t, root, "sys/class/net/eth0/carrier", "1\n")
+	// wired device without link
+	writeFakeFile(t, root, "sys/class/net/enx00e04c000008/device/uevent", "DRIVER=r8152\n")
+	writeFakeFile(t, root, "sys/class/net/enx00e04c000008/type", "1\n")
+	writeFakeFile(t, root, "sys/class/net/enx00e04c000008/carrier", "0\n")
+	// wired device that is down, reading its carrier fails
+	writeFakeFile(t, root, "sys/class/net/enp0s31f6/device/uevent", "DRIVER=e1000e\n")
+	writeFakeFile(t, root, "sys/class/net/enp0s31f6/type", "1\n")
+	// wireless devices
+	writeFakeFile(t, root, "sys/class/net/wlan0/device/uevent", "DRIVER=iwlwifi\n")
+	writeFakeFile(t, root, "sys/class/net/wlan0/type", "1\n")
+	writeFakeFile(t, root, "sys/class/net/wlan0/carrier", "1\n")
+	writeFakeFile(t, root, "sys/class/net/wlan0/wireless/uevent", "")
+	writeFakeFile(t, root, "sys/class/net/wlp2s0/device/uevent", "DRIVER=ath10k_pci\n")
+	writeFakeFile(t, root, "sys/class/net/wlp2s0/type", "1\n")
+	writeFakeFile(t, root, "sys/class/net/wlp2s0/phy80211/name", "phy0\n")
+	// virtual devices
+	writeFakeFile(t, root, "sys/class/net/lo/type", "772\n")
+	writeFakeFile(t, root, "sys/class/net/lo/carrier", "1\n")
+	writeFakeFile(t, root, "sys/class/net/docker0/type", "1\n")
+	writeFakeFile(t, root, "sys/class/net/docker0/carrier", "1\n")
+	// physical device that isn't ethernet, e.g. a mobile broadband modem
+	writeFakeFile(t, root, "sys/class/net/wwan0/device/uevent", "DRIVER=qmi_wwan\n")
+	writeFakeFile(t, root, "sys/class/net/wwan0/type", "519\n")
+
+	devices, err := NewSysfsEthernetBackend(root).GetEthernetDevices()
+	if err != nil {
+		t.Fatalf("GetEthernetDevices() failed: %v", err)
+	}
+	want := []EthernetDevice{
+		{Name: "enp0s31f6", Link: EthernetLinkDown},
+		{Name: "enx00e04c000008", Link: EthernetLinkDown},
+		{Name: "eth0", Link: EthernetLinkUp},
+	}
+	if !slices.Equal(devices, want) {
+		t.Errorf("GetEthernetDevices() = %v, want %v", devices, want)
+	}
+}
+
+func TestNetworksetupEthernetDevices(t *testing.T) {
+	runner := &fakeCommandRunner{outputs: map[string]string{
+		"networksetup -listallhardwareports": readFixture(t, "networksetup-listallhardwareports.txt"),
+		"ifconfig en0":                       readFixture(t, "ifconfig-en0.txt"),
+		"ifconfig bridge0":                   readFixture(t, "ifconfig-bridge0.txt"),
+		"ifconfig en8":                       readFixture(t, "ifconfig-en8.txt"),
+	}}
+	devices, err := NewNetworksetupEthernetBackend(runner).GetEthernetDevices()
+	if err != nil {
+		t.Fatalf("GetEthernetDevices() failed: %v", err)
+	}
+	want := []EthernetDevice{
+		{Name: "en0", Port: "Ethernet", Link: EthernetLinkUp},
+		{Name: "bridge0", Port: "Thunderbolt Bridge", Link: EthernetLinkDown},
+		{Name: "en8", Port: "USB 10/100/1000 LAN", Link: EthernetLinkDown},
+	}
+	if !slices.Equal(devices, want) {
+		t.Errorf("GetEthernetDevices() = %v, want %v", devices, want)
+	}
+	for _, command := range runner.run {
+		if command == "ifconfig en1" || command == "ifconfig en7" {
+			t.Errorf("queried WLAN port as ethernet: %s", command)
+		}
+	}
+}
+
+func TestNetworksetupEthernetDevicesSkipsFailingPorts(t *testing.T) {
+	runner := &fakeCommandRunner{outputs: map[string]string{
+		"networksetup -listallhardwareports": readFixture(t, "networksetup-listallhardwareports.txt"),
+		"ifconfig en0":                       readFixture(t, "ifconfig-en0.txt"),
+	}}
+	devices, err := NewNetworksetupEthernetBackend(runner).GetEthernetDevices()
+	if err != nil {
+		t.Fatalf("GetEthernetDevices() failed: %v", err)
+	}
+	want := []EthernetDevice{{Name: "en0", Port: "Ethernet", Link: EthernetLinkUp}}
+	if !slices.Equal(devices, want) {
+		t.Errorf("GetEthernetDevices() = %v, want %v", devices, want)
+	}
+}
+
+// fakeEthernetBackend returns the devices set by the test.
+type fakeEthernetBackend struct {
+	devices []EthernetDevice
+	err     error
+}
+
+func (b *fakeEthernetBackend) GetEthernetDevices() ([]EthernetDevice, error) {
+	return CopyEthernetDevices(b.devices), b.err
+}
+
+func TestQueryEthernetPublishesChanges(t *testing.T) {
+	backend := &fakeEthernetBackend{devices: []EthernetDevice{{Name: "eth0", Link: EthernetLinkDown}}}
+	s := &Service{ethernetBackend: backend, publishEvents: make(chan interface{}, 10)}
+
+	// each step changes the backend and tells whether the next query publishes an event
+	steps := []struct {
+		name    string
+		change  func()
+		publish bool
+	}{
+		{"first query", func() {}, true},
+		{"unchanged", func() {}, false},
+		{"link up", func() { backend.devices[0].Link = EthernetLinkUp }, true},
+		{"device added", func() {
+			backend.devices = append(backend.devices, EthernetDevice{Name: "eth1", Link: EthernetLinkDown})
+		}, true},
+		{"query failed", func() { backend.err = errors.New("failed") }, false},
+		{"unchanged after failure", func() { backend.err = nil }, false},
+		{"device removed", func() { backend.devices = backend.devices[:1] }, true},
+	}
+	for _, step := range steps {
+		step.change()
+		s.queryEthernet()
+		select {
+		case event := <-s.publishEvents:
+			ethernetEvent, ok := event.(EthernetStateChangedEvent)
+			if !step.publish {
+				t.Errorf("%s: published %v, want nothing", step.name, event)
+			} else if !ok || !slices.Equal(ethernetEvent.Devices, backend.devices) {
+				t.Errorf("%s: published %v, want devices %v", step.name, event, backend.devices)
+			}
+		default:
+			if step.publish {
+				t.Errorf("%s: published nothing, want devices %v", step.name, backend.devices)
+			}
+		}
+		if devices := s.GetEthernetDevices(); backend.err == nil && !slices.Equal(devices, backend.devices) {
+			t.Errorf("%s: GetEthernetDevices() = %v, want %v", step.name, devices, backend.devices)
+		}
+	}
+}
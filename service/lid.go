@@ -16,14 +16,7 @@
 // Copyright 2023 Manuel Koch
 package service
 
-import (
-	"fmt"
-	"os/exec"
-	"regexp"
-	"strings"
-
-	"github.com/manuel-koch/go-auto-wlan/utils"
-)
+import "context"
 
 type LidState int
 
@@ -44,33 +37,40 @@ func LidStateToString(state LidState) string {
 	}
 }
 
-func getLidState() (LidState, error) {
-	//ioreg -r -k AppleClamshellState -d 4 | grep AppleClamshellState | grep -i yes >/dev/null
+// LidSensor abstracts the platform specific way
+// to query the state of the laptop lid.
+type LidSensor interface {
+	// GetLidState returns the current state of the lid.
+	GetLidState() (LidState, error)
+	// HasExternalDisplay returns whether an external display is connected,
+	// which keeps the system running in clamshell mode when the lid is closed.
+	HasExternalDisplay() (bool, error)
+}
 
-	logger.Debug("Getting lid state...")
-	lidState := LidUnknown
+// LidEventSource abstracts the platform specific way
+// to get notified about lid changes as they happen.
+type LidEventSource interface {
+	// WatchLid delivers lid states until given context is done or the source fails.
+	WatchLid(ctx context.Context, states chan<- LidState) error
+}
 
-	cmd := exec.Command("ioreg", "-r", "-k", "AppleClamshellState", "-d", "4")
-	if output, err := cmd.Output(); err != nil {
-		logger.Error(fmt.Sprintf("Failed to get lid state: %v", err))
-		return lidState, err
-	} else {
-		appleClamshellStateRe := regexp.MustCompile("\"AppleClamshellState\"\\s*=\\s*(?P<state>\\S+)")
-		lines := strings.Split(string(output), "\n")
-		for line := range lines {
-			matches := utils.MatchNamedExpression(appleClamshellStateRe, lines[line])
-			if matches != nil {
-				switch strings.ToLower(matches["state"]) {
-				case "yes":
-					lidState = LidClosed
-				case "no":
-					lidState = LidOpen
-				}
-				break
-			}
-		}
+// NewPlatformLidEventSource returns the lid event source for named platform, e.g. "darwin" or "linux".
+// Returns nil when the platform only supports polling.
+func NewPlatformLidEventSource(platform string) LidEventSource {
+	switch platform {
+	case "linux":
+		return NewAcpidLidEventSource(AcpidSocketPath)
+	default:
+		return nil
 	}
+}
 
-	logger.Debug(fmt.Sprintf("Got lid state %s", LidStateToString(lidState)))
-	return lidState, nil
+// NewPlatformLidSensor returns the lid sensor for named platform, e.g. "darwin" or "linux".
+func NewPlatformLidSensor(platform string, runner CommandRunner) LidSensor {
+	switch platform {
+	case "linux":
+		return NewAcpiLidSensor("/")
+	default:
+		return NewIoregLidSensor(runner)
+	}
 }
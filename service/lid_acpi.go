@@ -0,0 +1,112 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/manuel-koch/go-auto-wlan/utils"
+)
+
+// AcpiLidSensor queries the lid state on Linux
+// by reading "/proc/acpi/button/lid/*/state"
+// and external displays from "/sys/class/drm".
+type AcpiLidSensor struct {
+	root string
+	// missingLogged avoids logging a missing lid on every poll, e.g. on desktops and servers
+	missingLogged atomic.Bool
+}
+
+// NewAcpiLidSensor returns a lid sensor reading procfs and sysfs below given root path,
+// which is "/" for the real system.
+func NewAcpiLidSensor(root string) *AcpiLidSensor {
+	return &AcpiLidSensor{root: root}
+}
+
+func (l *AcpiLidSensor) GetLidState() (LidState, error) {
+	logger.Debug("Getting lid state...")
+	lidState := LidUnknown
+
+	statePaths, err := filepath.Glob(filepath.Join(l.root, "proc", "acpi", "button", "lid", "*", "state"))
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to search lid state: %v", err))
+		return lidState, err
+	}
+	if len(statePaths) == 0 {
+		err := fmt.Errorf("no lid found below %s", l.root)
+		if l.missingLogged.CompareAndSwap(false, true) {
+			logger.Warn(fmt.Sprintf("Lid state is unknown: %v", err))
+		} else {
+			logger.Debug(fmt.Sprintf("Lid state is still unknown: %v", err))
+		}
+		return lidState, err
+	}
+
+	output, err := os.ReadFile(statePaths[0])
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get lid state: %v", err))
+		return lidState, err
+	}
+
+	stateRe := regexp.MustCompile("state:\\s*(?P<state>\\S+)")
+	lines := strings.Split(string(output), "\n")
+	for _, line := range lines {
+		stateMatch := utils.MatchNamedExpression(stateRe, line)
+		if stateMatch != nil {
+			switch strings.ToLower(stateMatch["state"]) {
+			case "open":
+				lidState = LidOpen
+			case "closed":
+				lidState = LidClosed
+			}
+			break
+		}
+	}
+
+	logger.Debug(fmt.Sprintf("Got lid state %s", LidStateToString(lidState)))
+	return lidState, nil
+}
+
+// internalConnectorRe matches DRM connectors of built-in panels, e.g. "card0-eDP-1".
+var internalConnectorRe = regexp.MustCompile("-(eDP|LVDS|DSI)-")
+
+func (l *AcpiLidSensor) HasExternalDisplay() (bool, error) {
+	logger.Debug("Getting external display...")
+
+	connectors, err := filepath.Glob(filepath.Join(l.root, "sys", "class", "drm", "card*-*"))
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to search display connectors: %v", err))
+		return false, err
+	}
+	for _, connector := range connectors {
+		if internalConnectorRe.MatchString(filepath.Base(connector)) {
+			continue
+		}
+		if status, err := readSysfsValue(filepath.Join(connector, "status")); err == nil && status == "connected" {
+			logger.Debug(fmt.Sprintf("Got external display %s", filepath.Base(connector)))
+			return true, nil
+		}
+	}
+
+	logger.Debug("Got no external display")
+	return false, nil
+}
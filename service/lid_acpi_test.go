@@ -0,0 +1,96 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFakeFile writes content to the file at given path below root, creating parent directories.
+func writeFakeFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	fullPath := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcpiLidSensorGetLidState(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     string
+		wantState LidState
+		wantErr   bool
+	}{
+		{name: "open", state: "state:      open\n", wantState: LidOpen},
+		{name: "closed", state: "state:      closed\n", wantState: LidClosed},
+		{name: "unexpected", state: "state:      ajar\n", wantState: LidUnknown},
+		{name: "missing", wantState: LidUnknown, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if len(tt.state) > 0 {
+				writeFakeFile(t, root, "proc/acpi/button/lid/LID0/state", tt.state)
+			}
+			sensor := NewAcpiLidSensor(root)
+			// query twice, a missing lid must keep failing after being logged once
+			for i := 0; i < 2; i++ {
+				lidState, err := sensor.GetLidState()
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("GetLidState() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if lidState != tt.wantState {
+					t.Errorf("GetLidState() = %s, want %s", LidStateToString(lidState), LidStateToString(tt.wantState))
+				}
+			}
+		})
+	}
+}
+
+func TestAcpiLidSensorHasExternalDisplay(t *testing.T) {
+	tests := []struct {
+		name       string
+		connectors map[string]string
+		want       bool
+	}{
+		{name: "none", want: false},
+		{name: "internal only", connectors: map[string]string{"card0-eDP-1": "connected"}, want: false},
+		{name: "external disconnected", connectors: map[string]string{"card0-eDP-1": "connected", "card0-HDMI-A-1": "disconnected"}, want: false},
+		{name: "external connected", connectors: map[string]string{"card0-eDP-1": "connected", "card0-DP-2": "connected"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for connector, status := range tt.connectors {
+				writeFakeFile(t, root, filepath.Join("sys/class/drm", connector, "status"), status+"\n")
+			}
+			got, err := NewAcpiLidSensor(root).HasExternalDisplay()
+			if err != nil {
+				t.Fatalf("HasExternalDisplay() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("HasExternalDisplay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
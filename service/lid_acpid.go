@@ -0,0 +1,99 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AcpidSocketPath is the default path of the acpid event socket.
+const AcpidSocketPath = "/var/run/acpid.socket"
+
+// AcpidLidEventSource delivers lid changes on Linux
+// by listening to the event socket of acpid,
+// which reports lines like "button/lid LID close".
+type AcpidLidEventSource struct {
+	socketPath string
+}
+
+func NewAcpidLidEventSource(socketPath string) *AcpidLidEventSource {
+	return &AcpidLidEventSource{socketPath: socketPath}
+}
+
+func (l *AcpidLidEventSource) WatchLid(ctx context.Context, states chan<- LidState) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", l.socketPath)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// unblock the pending read when we are done,
+	// stop waiting once the connection is gone
+	done := make(chan interface{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	logger.Info(fmt.Sprintf("Listening for lid events at %s", l.socketPath))
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		lidState := parseAcpidLidEvent(scanner.Text())
+		if lidState == LidUnknown {
+			continue
+		}
+		logger.Debug(fmt.Sprintf("Got lid event %s", LidStateToString(lidState)))
+		select {
+		case states <- lidState:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("acpid closed event socket")
+}
+
+// parseAcpidLidEvent returns the lid state of an acpid event line
+// or LidUnknown if the event is not about the lid.
+func parseAcpidLidEvent(line string) LidState {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || fields[0] != "button/lid" {
+		return LidUnknown
+	}
+	switch fields[2] {
+	case "open":
+		return LidOpen
+	case "close":
+		return LidClosed
+	default:
+		return LidUnknown
+	}
+}
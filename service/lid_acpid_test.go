@@ -0,0 +1,117 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcpidLidEventSource(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "acpid.socket")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// stand-in for acpid, emits some events and drops the connection
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, line := range []string{
+			"ac_adapter ACPI0003:00 00000080 00000000",
+			"button/lid LID close",
+			"button/power PBTN 00000080 00000000",
+			"button/lid LID open",
+		} {
+			if _, err := conn.Write([]byte(line + "\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	states := make(chan LidState, 10)
+	err = NewAcpidLidEventSource(socketPath).WatchLid(ctx, states)
+	if err == nil {
+		t.Errorf("WatchLid() should fail when acpid closes the socket")
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("WatchLid() did not return before timeout")
+	}
+	close(states)
+
+	want := []LidState{LidClosed, LidOpen}
+	got := make([]LidState, 0)
+	for state := range states {
+		got = append(got, state)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("WatchLid() delivered %d states, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("state %d = %s, want %s", i, LidStateToString(got[i]), LidStateToString(want[i]))
+		}
+	}
+}
+
+func TestAcpidLidEventSourceCancel(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "acpid.socket")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		// keep the connection open without any events until the client closes it
+		if conn, err := listener.Accept(); err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() { result <- NewAcpidLidEventSource(socketPath).WatchLid(ctx, make(chan LidState)) }()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("WatchLid() after cancel error = %v, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("WatchLid() did not return after cancel")
+	}
+}
+
+func TestAcpidLidEventSourceMissingSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "acpid.socket")
+	if err := NewAcpidLidEventSource(socketPath).WatchLid(context.Background(), make(chan LidState)); err == nil {
+		t.Errorf("WatchLid() without acpid should fail")
+	}
+}
@@ -0,0 +1,90 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/manuel-koch/go-auto-wlan/utils"
+)
+
+// IoregLidSensor queries the lid state on MacOS
+// using the "ioreg" command.
+type IoregLidSensor struct {
+	runner CommandRunner
+}
+
+func NewIoregLidSensor(runner CommandRunner) *IoregLidSensor {
+	return &IoregLidSensor{runner: runner}
+}
+
+func (l *IoregLidSensor) GetLidState() (LidState, error) {
+	//ioreg -r -k AppleClamshellState -d 4 | grep AppleClamshellState | grep -i yes >/dev/null
+
+	logger.Debug("Getting lid state...")
+	lidState := LidUnknown
+
+	if output, err := l.runner.Output("ioreg", "-r", "-k", "AppleClamshellState", "-d", "4"); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get lid state: %v", err))
+		return lidState, err
+	} else {
+		appleClamshellStateRe := regexp.MustCompile("\"AppleClamshellState\"\\s*=\\s*(?P<state>\\S+)")
+		lines := strings.Split(string(output), "\n")
+		for line := range lines {
+			matches := utils.MatchNamedExpression(appleClamshellStateRe, lines[line])
+			if matches != nil {
+				switch strings.ToLower(matches["state"]) {
+				case "yes":
+					lidState = LidClosed
+				case "no":
+					lidState = LidOpen
+				}
+				break
+			}
+		}
+	}
+
+	logger.Debug(fmt.Sprintf("Got lid state %s", LidStateToString(lidState)))
+	return lidState, nil
+}
+
+// HasExternalDisplay uses "AppleClamshellCausesSleep", which is only
+// "No" while an external display keeps the system awake with closed lid.
+func (l *IoregLidSensor) HasExternalDisplay() (bool, error) {
+	logger.Debug("Getting external display...")
+	externalDisplay := false
+
+	if output, err := l.runner.Output("ioreg", "-r", "-k", "AppleClamshellState", "-d", "4"); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get clamshell sleep: %v", err))
+		return externalDisplay, err
+	} else {
+		causesSleepRe := regexp.MustCompile("\"AppleClamshellCausesSleep\"\\s*=\\s*(?P<sleep>\\S+)")
+		lines := strings.Split(string(output), "\n")
+		for _, line := range lines {
+			matches := utils.MatchNamedExpression(causesSleepRe, line)
+			if matches != nil {
+				externalDisplay = strings.ToLower(matches["sleep"]) == "no"
+				break
+			}
+		}
+	}
+
+	logger.Debug(fmt.Sprintf("Got external display %t", externalDisplay))
+	return externalDisplay, nil
+}
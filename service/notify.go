@@ -0,0 +1,73 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// Notifier abstracts the platform specific way
+// to show a desktop notification.
+type Notifier interface {
+	// Notify shows a notification with given title and message.
+	Notify(title, message string) error
+}
+
+// NewPlatformNotifier returns the notifier for named platform, e.g. "darwin" or "linux".
+// Returns nil when the required tools are not installed.
+func NewPlatformNotifier(platform string, runner CommandRunner) Notifier {
+	switch platform {
+	case "linux":
+		if _, err := exec.LookPath("notify-send"); err != nil {
+			return nil
+		}
+		return &NotifySendNotifier{runner: runner}
+	default:
+		return &OsascriptNotifier{runner: runner}
+	}
+}
+
+// OsascriptNotifier shows notifications on MacOS
+// using the "osascript" command.
+type OsascriptNotifier struct {
+	runner CommandRunner
+}
+
+func (n *OsascriptNotifier) Notify(title, message string) error {
+	script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(message), strconv.Quote(title))
+	if _, err := n.runner.Output("osascript", "-e", script); err != nil {
+		logger.Error(fmt.Sprintf("Failed to show notification: %v", err))
+		return err
+	}
+	return nil
+}
+
+// NotifySendNotifier shows notifications on Linux
+// using the "notify-send" command.
+type NotifySendNotifier struct {
+	runner CommandRunner
+}
+
+func (n *NotifySendNotifier) Notify(title, message string) error {
+	if _, err := n.runner.Output("notify-send", title, message); err != nil {
+		logger.Error(fmt.Sprintf("Failed to show notification: %v", err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import "fmt"
+
+type PowerSource int
+
+const (
+	PowerSourceUnknown PowerSource = iota
+	PowerSourceAC      PowerSource = iota
+	PowerSourceBattery PowerSource = iota
+)
+
+// PowerState is the current power source and battery level.
+type PowerState struct {
+	Source PowerSource
+	// Percentage is the battery level, -1 if there is no battery.
+	Percentage int
+}
+
+// PowerSourceBackend abstracts the platform specific way
+// to query power source and battery level.
+type PowerSourceBackend interface {
+	// GetPowerState returns the current power source and battery level.
+	GetPowerState() (PowerState, error)
+}
+
+// NewPlatformPowerSourceBackend returns the power source backend for named platform, e.g. "darwin" or "linux".
+func NewPlatformPowerSourceBackend(platform string, runner CommandRunner) PowerSourceBackend {
+	switch platform {
+	case "linux":
+		return NewSysfsPowerSourceBackend("/")
+	default:
+		return NewPmsetPowerSourceBackend(runner)
+	}
+}
+
+func (p *PowerState) String() string {
+	s := PowerSourceToString(p.Source)
+	if p.Percentage >= 0 {
+		s += fmt.Sprintf(" (%d%%)", p.Percentage)
+	}
+	return s
+}
+
+// IsBatteryBelow returns whether running on battery with a level below given percentage.
+func (p *PowerState) IsBatteryBelow(percentage int) bool {
+	return p.Source == PowerSourceBattery && p.Percentage >= 0 && p.Percentage < percentage
+}
+
+func PowerSourceToString(source PowerSource) string {
+	switch source {
+	case PowerSourceAC:
+		return "AC"
+	case PowerSourceBattery:
+		return "battery"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,68 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/manuel-koch/go-auto-wlan/utils"
+)
+
+// PmsetPowerSourceBackend queries power source and battery level on MacOS
+// using the "pmset" command.
+type PmsetPowerSourceBackend struct {
+	runner CommandRunner
+}
+
+func NewPmsetPowerSourceBackend(runner CommandRunner) *PmsetPowerSourceBackend {
+	return &PmsetPowerSourceBackend{runner: runner}
+}
+
+func (b *PmsetPowerSourceBackend) GetPowerState() (PowerState, error) {
+	logger.Debug("Getting power state...")
+	powerState := PowerState{Source: PowerSourceUnknown, Percentage: -1}
+
+	if output, err := b.runner.Output("pmset", "-g", "batt"); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get power state: %v", err))
+		return powerState, err
+	} else {
+		sourceRe := regexp.MustCompile("Now drawing from '(?P<source>[^']+)'")
+		percentageRe := regexp.MustCompile("InternalBattery.*\\s(?P<percentage>\\d+)%")
+		lines := strings.Split(string(output), "\n")
+		for _, line := range lines {
+			if sourceMatch := utils.MatchNamedExpression(sourceRe, line); sourceMatch != nil {
+				switch sourceMatch["source"] {
+				case "AC Power":
+					powerState.Source = PowerSourceAC
+				case "Battery Power":
+					powerState.Source = PowerSourceBattery
+				}
+			}
+			if percentageMatch := utils.MatchNamedExpression(percentageRe, line); percentageMatch != nil {
+				if percentage, err := strconv.Atoi(percentageMatch["percentage"]); err == nil {
+					powerState.Percentage = percentage
+				}
+			}
+		}
+	}
+
+	logger.Debug(fmt.Sprintf("Got power state %s", powerState.String()))
+	return powerState, nil
+}
@@ -0,0 +1,129 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// SysfsPowerSourceBackend queries power source and battery level on Linux
+// using "/sys/class/power_supply".
+type SysfsPowerSourceBackend struct {
+	root string
+}
+
+// NewSysfsPowerSourceBackend returns a power source backend using sysfs below given root path,
+// which is "/" for the real system.
+func NewSysfsPowerSourceBackend(root string) *SysfsPowerSourceBackend {
+	return &SysfsPowerSourceBackend{root: root}
+}
+
+func (b *SysfsPowerSourceBackend) GetPowerState() (PowerState, error) {
+	logger.Debug("Getting power state...")
+	powerState := PowerState{Source: PowerSourceUnknown, Percentage: -1}
+
+	supplies, err := filepath.Glob(filepath.Join(b.root, "sys", "class", "power_supply", "*"))
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get power supplies: %v", err))
+		return powerState, err
+	}
+
+	online := false
+	batteries := make([]sysfsBattery, 0)
+	for _, supply := range supplies {
+		kind, err := readSysfsValue(filepath.Join(supply, "type"))
+		if err != nil {
+			continue
+		}
+		switch kind {
+		case "Mains", "USB":
+			if value, err := readSysfsValue(filepath.Join(supply, "online")); err == nil && value == "1" {
+				online = true
+			}
+		case "Battery":
+			// skip batteries of peripherals like mice
+			if scope, err := readSysfsValue(filepath.Join(supply, "scope")); err == nil && scope == "Device" {
+				continue
+			}
+			batteries = append(batteries, readSysfsBattery(supply))
+		}
+	}
+	if online {
+		powerState.Source = PowerSourceAC
+	} else if len(batteries) > 0 {
+		powerState.Source = PowerSourceBattery
+	}
+	powerState.Percentage = combinedBatteryPercentage(batteries)
+
+	logger.Debug(fmt.Sprintf("Got power state %s", powerState.String()))
+	return powerState, nil
+}
+
+// sysfsBattery is the level of one battery.
+type sysfsBattery struct {
+	// percentage is -1 if unknown
+	percentage int
+	// full is the energy or charge when fully charged, 0 if unknown
+	full int64
+}
+
+func readSysfsBattery(path string) sysfsBattery {
+	battery := sysfsBattery{percentage: -1}
+	if value, err := readSysfsValue(filepath.Join(path, "capacity")); err == nil {
+		if percentage, err := strconv.Atoi(value); err == nil {
+			battery.percentage = percentage
+		}
+	}
+	for _, name := range []string{"energy_full", "charge_full"} {
+		if value, err := readSysfsValue(filepath.Join(path, name)); err == nil {
+			if full, err := strconv.ParseInt(value, 10, 64); err == nil && full > 0 {
+				battery.full = full
+				break
+			}
+		}
+	}
+	return battery
+}
+
+// combinedBatteryPercentage returns the level of all given batteries, -1 if unknown,
+// e.g. of the internal and the swappable battery of some laptops.
+// Batteries are weighted by their full energy or charge if known for all of them.
+func combinedBatteryPercentage(batteries []sysfsBattery) int {
+	count := 0
+	sum := 0
+	weighted := true
+	var weightedSum, fullSum int64
+	for _, battery := range batteries {
+		if battery.percentage < 0 {
+			continue
+		}
+		count++
+		sum += battery.percentage
+		weighted = weighted && battery.full > 0
+		weightedSum += int64(battery.percentage) * battery.full
+		fullSum += battery.full
+	}
+	if count == 0 {
+		return -1
+	}
+	if weighted {
+		return int((weightedSum + fullSum/2) / fullSum)
+	}
+	return (sum + count/2) / count
+}
@@ -0,0 +1,131 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"testing"
+)
+
+func TestPmsetPowerState(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    PowerState
+	}{
+		{"pmset-batt-ac-no-battery.txt", PowerState{Source: PowerSourceAC, Percentage: -1}},
+		{"pmset-batt-charging.txt", PowerState{Source: PowerSourceAC, Percentage: 62}},
+		{"pmset-batt-not-charging.txt", PowerState{Source: PowerSourceAC, Percentage: 80}},
+		{"pmset-batt-discharging.txt", PowerState{Source: PowerSourceBattery, Percentage: 7}},
+		// the level of an UPS doesn't count as battery level
+		{"pmset-batt-ups.txt", PowerState{Source: PowerSourceAC, Percentage: 95}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			runner := &fakeCommandRunner{outputs: map[string]string{"pmset -g batt": readFixture(t, tt.fixture)}}
+			powerState, err := NewPmsetPowerSourceBackend(runner).GetPowerState()
+			if err != nil {
+				t.Fatalf("GetPowerState() failed: %v", err)
+			}
+			if powerState != tt.want {
+				t.Errorf("GetPowerState() = %s, want %s", powerState.String(), tt.want.String())
+			}
+		})
+	}
+
+	if _, err := NewPmsetPowerSourceBackend(&fakeCommandRunner{}).GetPowerState(); err == nil {
+		t.Errorf("GetPowerState() without pmset succeeded")
+	}
+}
+
+func TestSysfsPowerState(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  PowerState
+	}{
+		{"no power supplies", map[string]string{}, PowerState{Source: PowerSourceUnknown, Percentage: -1}},
+		{"AC without battery", map[string]string{
+			"AC/type": "Mains", "AC/online": "1",
+		}, PowerState{Source: PowerSourceAC, Percentage: -1}},
+		{"charging", map[string]string{
+			"AC/type": "Mains", "AC/online": "1",
+			"BAT0/type": "Battery", "BAT0/status": "Charging", "BAT0/capacity": "62",
+		}, PowerState{Source: PowerSourceAC, Percentage: 62}},
+		{"AC attached not charging", map[string]string{
+			"ADP1/type": "Mains", "ADP1/online": "1",
+			"BAT1/type": "Battery", "BAT1/status": "Not charging", "BAT1/capacity": "80",
+		}, PowerState{Source: PowerSourceAC, Percentage: 80}},
+		{"discharging", map[string]string{
+			"AC/type": "Mains", "AC/online": "0",
+			"BAT0/type": "Battery", "BAT0/status": "Discharging", "BAT0/capacity": "7",
+		}, PowerState{Source: PowerSourceBattery, Percentage: 7}},
+		{"USB-C power", map[string]string{
+			"ucsi-source-psy-USBC000:001/type": "USB", "ucsi-source-psy-USBC000:001/online": "1",
+			"BAT0/type": "Battery", "BAT0/capacity": "90",
+		}, PowerState{Source: PowerSourceAC, Percentage: 90}},
+		{"peripheral battery", map[string]string{
+			"hidpp_battery_0/type": "Battery", "hidpp_battery_0/scope": "Device", "hidpp_battery_0/capacity": "15",
+			"BAT0/type": "Battery", "BAT0/capacity": "55",
+		}, PowerState{Source: PowerSourceBattery, Percentage: 55}},
+		{"several batteries by energy", map[string]string{
+			"BAT0/type": "Battery", "BAT0/capacity": "50", "BAT0/energy_full": "40000000",
+			"BAT1/type": "Battery", "BAT1/capacity": "30", "BAT1/energy_full": "20000000",
+		}, PowerState{Source: PowerSourceBattery, Percentage: 43}},
+		{"several batteries by charge", map[string]string{
+			"BAT0/type": "Battery", "BAT0/capacity": "100", "BAT0/charge_full": "3000000",
+			"BAT1/type": "Battery", "BAT1/capacity": "10", "BAT1/charge_full": "1000000",
+		}, PowerState{Source: PowerSourceBattery, Percentage: 78}},
+		{"several batteries without full level", map[string]string{
+			"BAT0/type": "Battery", "BAT0/capacity": "50", "BAT0/energy_full": "40000000",
+			"BAT1/type": "Battery", "BAT1/capacity": "31",
+		}, PowerState{Source: PowerSourceBattery, Percentage: 41}},
+		{"battery without level", map[string]string{
+			"BAT0/type": "Battery",
+		}, PowerState{Source: PowerSourceBattery, Percentage: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for path, content := range tt.files {
+				writeFakeFile(t, root, "sys/class/power_supply/"+path, content+"\n")
+			}
+			powerState, err := NewSysfsPowerSourceBackend(root).GetPowerState()
+			if err != nil {
+				t.Fatalf("GetPowerState() failed: %v", err)
+			}
+			if powerState != tt.want {
+				t.Errorf("GetPowerState() = %s, want %s", powerState.String(), tt.want.String())
+			}
+		})
+	}
+}
+
+func TestIsBatteryBelow(t *testing.T) {
+	tests := []struct {
+		powerState PowerState
+		want       bool
+	}{
+		{PowerState{Source: PowerSourceBattery, Percentage: 19}, true},
+		{PowerState{Source: PowerSourceBattery, Percentage: 20}, false},
+		{PowerState{Source: PowerSourceAC, Percentage: 5}, false},
+		{PowerState{Source: PowerSourceBattery, Percentage: -1}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.powerState.IsBatteryBelow(20); got != tt.want {
+			t.Errorf("IsBatteryBelow(20) of %s = %t, want %t", tt.powerState.String(), got, tt.want)
+		}
+	}
+}
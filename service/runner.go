@@ -0,0 +1,207 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// CommandRunner runs the external commands used by the probes of the service.
+type CommandRunner interface {
+	// Output runs named command with given arguments and returns its standard output.
+	Output(name string, args ...string) ([]byte, error)
+}
+
+// ExecCommandRunner runs commands on the real system.
+type ExecCommandRunner struct{}
+
+func (r ExecCommandRunner) Output(name string, args ...string) ([]byte, error) {
+	stdout, stderr, err := r.Run(name, args...)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitErr.Stderr = stderr
+	}
+	return stdout, err
+}
+
+// Run runs named command with given arguments and returns its standard output
+// and standard error, the latter also for commands that succeeded.
+func (r ExecCommandRunner) Run(name string, args ...string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// runsOnSystem returns whether given runner runs commands on the real system,
+// so the tools it runs must be installed, unlike for replayed commands.
+func runsOnSystem(runner CommandRunner) bool {
+	switch runner.(type) {
+	case ExecCommandRunner, *RecordingCommandRunner:
+		return true
+	default:
+		return false
+	}
+}
+
+// CommandRecord is one command run, as saved by the RecordingCommandRunner.
+type CommandRecord struct {
+	Argv     []string `json:"argv"`
+	Stdout   string   `json:"stdout"`
+	Stderr   string   `json:"stderr"`
+	ExitCode int      `json:"exit_code"`
+}
+
+// CommandExitError is returned when a replayed command did exit with non-zero exit code.
+type CommandExitError struct {
+	Argv     []string
+	ExitCode int
+	Stderr   []byte
+}
+
+func (e CommandExitError) Error() string {
+	return fmt.Sprintf("Command '%s' exited with code %d", strings.Join(e.Argv, " "), e.ExitCode)
+}
+
+// CommandNotRecordedError is returned when a command to replay was never recorded.
+type CommandNotRecordedError struct {
+	Argv []string
+}
+
+func (e CommandNotRecordedError) Error() string {
+	return fmt.Sprintf("Command '%s' was not recorded", strings.Join(e.Argv, " "))
+}
+
+// RecordingCommandRunner runs commands on the real system
+// and appends every run to a file, one JSON encoded CommandRecord per line.
+type RecordingCommandRunner struct {
+	runner ExecCommandRunner
+	mutex  sync.Mutex
+	file   *os.File
+}
+
+// NewRecordingCommandRunner returns a runner recording to given path,
+// existing recordings are overwritten.
+func NewRecordingCommandRunner(path string) (*RecordingCommandRunner, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingCommandRunner{runner: ExecCommandRunner{}, file: file}, nil
+}
+
+func (r *RecordingCommandRunner) Output(name string, args ...string) ([]byte, error) {
+	stdout, stderr, err := r.runner.Run(name, args...)
+
+	record := CommandRecord{
+		Argv:   append([]string{name}, args...),
+		Stdout: string(stdout),
+		Stderr: string(stderr),
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitErr.Stderr = stderr
+		record.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		record.Stderr = err.Error()
+		record.ExitCode = -1
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if line, jsonErr := json.Marshal(record); jsonErr == nil {
+		if _, writeErr := r.file.Write(append(line, '\n')); writeErr != nil {
+			logger.Error(fmt.Sprintf("Failed to record command: %v", writeErr))
+		}
+	}
+
+	return stdout, err
+}
+
+// Close closes the file of recordings.
+func (r *RecordingCommandRunner) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.file.Close()
+}
+
+// ReplayCommandRunner serves commands from recordings instead of running them.
+// Recordings of the same command are replayed in recorded order,
+// the last one is repeated once all of them have been served.
+type ReplayCommandRunner struct {
+	mutex   sync.Mutex
+	records []CommandRecord
+	served  []bool
+}
+
+// NewReplayCommandRunner returns a runner replaying the recordings at given path.
+func NewReplayCommandRunner(path string) (*ReplayCommandRunner, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]CommandRecord, 0)
+	for i, line := range strings.Split(string(content), "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record CommandRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("invalid command record in line %d: %v", i+1, err)
+		}
+		records = append(records, record)
+	}
+	return &ReplayCommandRunner{records: records, served: make([]bool, len(records))}, nil
+}
+
+func (r *ReplayCommandRunner) Output(name string, args ...string) ([]byte, error) {
+	argv := append([]string{name}, args...)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	last := -1
+	for i, record := range r.records {
+		if !slices.Equal(record.Argv, argv) {
+			continue
+		}
+		last = i
+		if !r.served[i] {
+			break
+		}
+	}
+	if last < 0 {
+		return nil, CommandNotRecordedError{Argv: argv}
+	}
+	r.served[last] = true
+
+	record := r.records[last]
+	if record.ExitCode != 0 {
+		return []byte(record.Stdout), CommandExitError{Argv: argv, ExitCode: record.ExitCode, Stderr: []byte(record.Stderr)}
+	}
+	return []byte(record.Stdout), nil
+}
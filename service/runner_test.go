@@ -0,0 +1,99 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplayCommandRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("recorded commands need a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), "commands.jsonl")
+	succeeding := []string{"-c", "echo out; echo warning >&2"}
+	failing := []string{"-c", "echo partial; echo failure >&2; exit 3"}
+
+	recorder, err := NewRecordingCommandRunner(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordedStdout, err := recorder.Output("sh", succeeding...)
+	if err != nil {
+		t.Fatalf("recording succeeding command: %v", err)
+	}
+	if _, err := recorder.Output("sh", failing...); err == nil {
+		t.Fatalf("recording failing command should fail")
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("recorded %d commands, want 2", len(lines))
+	}
+	wantRecords := []CommandRecord{
+		{Argv: append([]string{"sh"}, succeeding...), Stdout: "out\n", Stderr: "warning\n", ExitCode: 0},
+		{Argv: append([]string{"sh"}, failing...), Stdout: "partial\n", Stderr: "failure\n", ExitCode: 3},
+	}
+	for i, line := range lines {
+		var record CommandRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		want := wantRecords[i]
+		if strings.Join(record.Argv, " ") != strings.Join(want.Argv, " ") || record.Stdout != want.Stdout ||
+			record.Stderr != want.Stderr || record.ExitCode != want.ExitCode {
+			t.Errorf("record %d = %+v, want %+v", i, record, want)
+		}
+	}
+
+	replayer, err := NewReplayCommandRunner(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// replay repeats the last recording of a command
+	for i := 0; i < 2; i++ {
+		stdout, err := replayer.Output("sh", succeeding...)
+		if err != nil || !bytes.Equal(stdout, recordedStdout) {
+			t.Errorf("replaying succeeding command = %q, %v, want %q", stdout, err, recordedStdout)
+		}
+	}
+	stdout, err := replayer.Output("sh", failing...)
+	var exitErr CommandExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 3 || string(exitErr.Stderr) != "failure\n" {
+		t.Errorf("replaying failing command error = %v, want exit code 3 with stderr", err)
+	}
+	if string(stdout) != "partial\n" {
+		t.Errorf("replaying failing command = %q, want partial output", stdout)
+	}
+	if _, err := replayer.Output("sh", "-c", "true"); !errors.As(err, &CommandNotRecordedError{}) {
+		t.Errorf("replaying unknown command error = %v, want CommandNotRecordedError", err)
+	}
+}
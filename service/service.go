@@ -20,22 +20,76 @@ import (
 	"context"
 	"fmt"
 	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/utils"
 )
 
 const (
-	LidUpdateInterval  = 3 * time.Second
-	WlanUpdateInterval = 3 * time.Second
+	LidEventRetryInterval  = 10 * time.Second
+	WlanEventPollInterval  = 60 * time.Second
+	WlanEventRetryInterval = 10 * time.Second
+	WlanEventDebounce      = 200 * time.Millisecond
+	SleepCheckInterval     = 5 * time.Second
+	SleepCheckThreshold    = 10 * time.Second
+)
+
+// Poll intervals, may be configured before creating the service.
+var (
+	LidUpdateInterval       = 3 * time.Second
+	WlanUpdateInterval      = 3 * time.Second
+	BluetoothUpdateInterval = 3 * time.Second
+	EthernetUpdateInterval  = 3 * time.Second
+	PowerUpdateInterval     = 10 * time.Second
 )
 
 type LidStateChangedEvent struct {
 	LidState LidState
+	// Clamshell is set when the lid is closed while an external display is connected.
+	Clamshell bool
+	// Replayed is set for events republished after the system woke up,
+	// the lid may have changed while the system was sleeping.
+	Replayed bool
 }
 
 type WlanStateChangedEvent struct {
 	Devices []WlanDevice
 }
 
+// WlanDeviceAddedEvent is published when a WLAN device appears, e.g. a USB dongle got plugged in.
+type WlanDeviceAddedEvent struct {
+	Device WlanDevice
+}
+
+// WlanDeviceRemovedEvent is published when a WLAN device disappears.
+type WlanDeviceRemovedEvent struct {
+	Device WlanDevice
+}
+
+// WlanDeviceChangedEvent is published when power, network or signal of a WLAN device changes.
+type WlanDeviceChangedEvent struct {
+	Device   WlanDevice
+	Previous WlanDevice
+}
+
+type BluetoothStateChangedEvent struct {
+	BluetoothState BluetoothState
+}
+
+type EthernetStateChangedEvent struct {
+	Devices []EthernetDevice
+}
+
+func NewEthernetStateChangedEvent(devices []EthernetDevice) EthernetStateChangedEvent {
+	return EthernetStateChangedEvent{Devices: CopyEthernetDevices(devices)}
+}
+
+type PowerStateChangedEvent struct {
+	PowerState PowerState
+}
+
 func NewWlanStateChangedEvent(devices []WlanDevice) WlanStateChangedEvent {
 	return WlanStateChangedEvent{Devices: CopyWlanDevices(devices)}
 }
@@ -43,16 +97,40 @@ func NewWlanStateChangedEvent(devices []WlanDevice) WlanStateChangedEvent {
 type Service struct {
 	ctx context.Context
 
-	wlanDevices []WlanDevice
-	lidState    LidState
+	wlanBackend      WlanBackend
+	wlanEventSource  WlanEventSource
+	lidSensor        LidSensor
+	lidEventSource   LidEventSource
+	bluetoothBackend BluetoothBackend
+	ethernetBackend  EthernetBackend
+	sleepEventSource SleepEventSource
+	powerBackend     PowerSourceBackend
+	notifier         Notifier
+
+	// stateMutex guards the state below, which is only changed by the goroutine watching it,
+	// that goroutine may read it without the lock.
+	stateMutex      sync.Mutex
+	wlanDevices     []WlanDevice
+	lidState        LidState
+	lidClamshell    bool
+	bluetoothState  BluetoothState
+	ethernetDevices []EthernetDevice
+	powerState      PowerState
 
 	pendingEvtSubscriptions  chan *EventSubscription
 	pendingEvtUnsubscription chan *EventSubscription
 	evtSubscriptions         []*EventSubscription
 	publishEvents            chan interface{}
 
-	requestLidUpdate  chan interface{}
-	requestWlanUpdate chan interface{}
+	lidEvents        chan LidState
+	lidEventsActive  atomic.Bool
+	wlanEvents       chan string
+	wlanEventsActive atomic.Bool
+	sleepEvents      chan SleepEvent
+
+	requestLidUpdate       chan interface{}
+	requestWlanUpdate      chan interface{}
+	requestBluetoothUpdate chan interface{}
 }
 
 type EventSubscription struct {
@@ -65,36 +143,98 @@ func (e *EventSubscription) Updates() <-chan interface{} {
 }
 
 func (e *EventSubscription) Unsubscribe() {
-	e.service.pendingEvtUnsubscription <- e
+	select {
+	case e.service.pendingEvtUnsubscription <- e:
+	case <-e.service.ctx.Done():
+		// all subscriptions get closed on shutdown
+	}
 }
 
-func NewService(ctx context.Context) *Service {
+func NewService(ctx context.Context, backends Backends) *Service {
 	s := &Service{
 		ctx:                      ctx,
+		wlanBackend:              backends.Wlan,
+		wlanEventSource:          backends.WlanEvents,
+		wlanEvents:               make(chan string),
+		lidSensor:                backends.Lid,
+		lidEventSource:           backends.LidEvents,
+		lidEvents:                make(chan LidState),
+		bluetoothBackend:         backends.Bluetooth,
+		ethernetBackend:          backends.Ethernet,
+		sleepEventSource:         backends.Sleep,
+		powerBackend:             backends.Power,
+		notifier:                 backends.Notifier,
+		powerState:               PowerState{Source: PowerSourceUnknown, Percentage: -1},
+		sleepEvents:              make(chan SleepEvent),
 		pendingEvtSubscriptions:  make(chan *EventSubscription),
 		pendingEvtUnsubscription: make(chan *EventSubscription),
 		publishEvents:            make(chan interface{}),
 		evtSubscriptions:         make([]*EventSubscription, 0),
 
-		requestLidUpdate:  make(chan interface{}, 0),
-		requestWlanUpdate: make(chan interface{}, 0),
+		requestLidUpdate:       make(chan interface{}, 0),
+		requestWlanUpdate:      make(chan interface{}, 0),
+		requestBluetoothUpdate: make(chan interface{}, 0),
 	}
 
-	if wifiDevices, err := getWlanDevices(); err == nil {
+	if wifiDevices, err := s.wlanBackend.GetWlanDevices(); err == nil {
 		s.wlanDevices = wifiDevices
 	}
-	if lidState, err := getLidState(); err == nil {
+	if lidState, err := s.lidSensor.GetLidState(); err == nil {
 		s.lidState = lidState
+		s.lidClamshell = s.queryClamshell(lidState)
+	}
+	if s.bluetoothBackend != nil {
+		if bluetoothState, err := s.bluetoothBackend.GetBluetoothState(); err == nil {
+			s.bluetoothState = bluetoothState
+		}
+	}
+	if s.ethernetBackend != nil {
+		if ethernetDevices, err := s.ethernetBackend.GetEthernetDevices(); err == nil {
+			s.ethernetDevices = ethernetDevices
+		}
+	}
+	if s.powerBackend != nil {
+		if powerState, err := s.powerBackend.GetPowerState(); err == nil {
+			s.powerState = powerState
+		}
 	}
 
 	for _, wlanDevice := range s.wlanDevices {
 		logger.Info(fmt.Sprintf("WLAN device %s", wlanDevice.String()))
 	}
 	logger.Info(fmt.Sprintf("Lid is %s", LidStateToString(s.lidState)))
+	if s.lidClamshell {
+		logger.Info("Running in clamshell mode")
+	}
+	if s.bluetoothBackend != nil {
+		logger.Info(fmt.Sprintf("Bluetooth is %s", BluetoothStateToString(s.bluetoothState)))
+	}
+	for _, ethernetDevice := range s.ethernetDevices {
+		logger.Info(fmt.Sprintf("Ethernet device %s", ethernetDevice.String()))
+	}
+	if s.powerBackend != nil {
+		logger.Info(fmt.Sprintf("Power source is %s", s.powerState.String()))
+	}
 
 	go s.handleSubscriptions()
 	go s.watchLid()
+	go s.watchSleepEvents()
+	if s.lidEventSource != nil {
+		go s.watchLidEvents()
+	}
 	go s.watchWlan()
+	if s.wlanEventSource != nil {
+		go s.watchWlanEvents()
+	}
+	if s.bluetoothBackend != nil {
+		go s.watchBluetooth()
+	}
+	if s.ethernetBackend != nil {
+		go s.watchEthernet()
+	}
+	if s.powerBackend != nil {
+		go s.watchPower()
+	}
 
 	return s
 }
@@ -125,8 +265,9 @@ func (s *Service) handleSubscriptions() {
 		case pendingUnsubscribe := <-s.pendingEvtUnsubscription:
 			for i, subscription := range s.evtSubscriptions {
 				if subscription == pendingUnsubscribe {
-					slices.Delete(s.evtSubscriptions, i, i)
+					s.evtSubscriptions = slices.Delete(s.evtSubscriptions, i, i+1)
 					close(subscription.updates)
+					break
 				}
 			}
 		case event := <-s.publishEvents:
@@ -138,9 +279,18 @@ func (s *Service) handleSubscriptions() {
 }
 
 func (s *Service) GetLidState() LidState {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
 	return s.lidState
 }
 
+// IsClamshell returns whether the lid is closed while an external display is connected.
+func (s *Service) IsClamshell() bool {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	return s.lidClamshell
+}
+
 func (s *Service) watchLid() {
 	logger.Info("Start watching lid...")
 	done := false
@@ -150,64 +300,408 @@ func (s *Service) watchLid() {
 			done = true
 		case <-s.requestLidUpdate:
 			s.queryLid()
+		case lidState := <-s.lidEvents:
+			s.updateLid(lidState)
+		case sleepEvent := <-s.sleepEvents:
+			if sleepEvent.Sleeping {
+				logger.Info(fmt.Sprintf("System going to sleep, lid is %s", LidStateToString(s.lidState)))
+			} else {
+				s.reconcileAfterWake()
+			}
 		case <-time.After(LidUpdateInterval):
-			s.queryLid()
+			// polling is only the fallback while lid events are not available,
+			// but they don't report external displays plugged while the lid is closed
+			if !s.lidEventsActive.Load() {
+				s.queryLid()
+			} else if s.lidState == LidClosed {
+				s.updateLid(s.lidState)
+			}
 		}
 	}
 	logger.Info("Stopped watching lid")
 }
 
-func (s *Service) queryLid() {
-	logger.Debug("Query lid")
-	if lidState, err := getLidState(); err == nil {
-		if lidState != s.lidState {
-			logger.Info(fmt.Sprintf("New lid state: %s", LidStateToString(lidState)))
-			s.lidState = lidState
+// watchLidEvents keeps listening to the lid event source,
+// reconnecting after failures.
+func (s *Service) watchLidEvents() {
+	logger.Info("Start watching lid events...")
+	done := false
+	warned := false
+	for !done {
+		s.lidEventsActive.Store(true)
+		err := s.lidEventSource.WatchLid(s.ctx, s.lidEvents)
+		s.lidEventsActive.Store(false)
+		if err != nil && !warned {
+			logger.Warn(fmt.Sprintf("Lid events not available, polling lid state: %v", err))
+			warned = true
+		} else if err != nil {
+			logger.Debug(fmt.Sprintf("Lid events still not available: %v", err))
+		}
+		select {
+		case <-s.ctx.Done():
+			done = true
+		case <-time.After(LidEventRetryInterval):
+		}
+	}
+	logger.Info("Stopped watching lid events")
+}
+
+// watchSleepEvents listens to the sleep event source,
+// falling back to detect wake by time gaps.
+func (s *Service) watchSleepEvents() {
+	logger.Info("Start watching sleep events...")
+	if s.sleepEventSource != nil {
+		if err := s.sleepEventSource.WatchSleep(s.ctx, s.sleepEvents); err != nil {
+			logger.Warn(fmt.Sprintf("Sleep events not available, detecting wake by time gaps: %v", err))
+		}
+	}
+	if s.ctx.Err() == nil {
+		timeGap := NewTimeGapSleepEventSource(SleepCheckInterval, SleepCheckThreshold, utils.RealClock{})
+		timeGap.WatchSleep(s.ctx, s.sleepEvents)
+	}
+	logger.Info("Stopped watching sleep events")
+}
+
+// reconcileAfterWake refreshes lid and wlan state after the system woke up.
+// Lid transitions may have happened while sleeping, so an unchanged lid state
+// is republished to let subscribers catch up.
+func (s *Service) reconcileAfterWake() {
+	logger.Info("System woke up, reconciling lid and wlan state")
+	if lidState, err := s.lidSensor.GetLidState(); err == nil {
+		clamshell := s.queryClamshell(lidState)
+		if lidState != s.lidState || clamshell != s.lidClamshell {
+			s.updateLid(lidState)
+		} else {
+			logger.Info(fmt.Sprintf("Replaying lid state: %s", LidStateToString(lidState)))
 			s.publishEvents <- LidStateChangedEvent{
-				LidState: lidState,
+				LidState:  lidState,
+				Clamshell: clamshell,
+				Replayed:  true,
 			}
 		}
 	}
+	go func() {
+		select {
+		case s.requestWlanUpdate <- true:
+		case <-s.ctx.Done():
+		}
+	}()
+}
+
+func (s *Service) queryLid() {
+	logger.Debug("Query lid")
+	if lidState, err := s.lidSensor.GetLidState(); err == nil {
+		s.updateLid(lidState)
+	}
 	logger.Debug("Queried lid")
 }
 
+func (s *Service) updateLid(lidState LidState) {
+	clamshell := s.queryClamshell(lidState)
+	if lidState != s.lidState || clamshell != s.lidClamshell {
+		if clamshell {
+			logger.Info(fmt.Sprintf("New lid state: %s (clamshell mode)", LidStateToString(lidState)))
+		} else {
+			logger.Info(fmt.Sprintf("New lid state: %s", LidStateToString(lidState)))
+		}
+		s.stateMutex.Lock()
+		s.lidState = lidState
+		s.lidClamshell = clamshell
+		s.stateMutex.Unlock()
+		s.publishEvents <- LidStateChangedEvent{
+			LidState:  lidState,
+			Clamshell: clamshell,
+		}
+	}
+}
+
+// queryClamshell returns whether given lid state means clamshell mode,
+// external displays only matter while the lid is closed.
+func (s *Service) queryClamshell(lidState LidState) bool {
+	if lidState != LidClosed {
+		return false
+	}
+	externalDisplay, err := s.lidSensor.HasExternalDisplay()
+	return err == nil && externalDisplay
+}
+
 func (s *Service) watchWlan() {
 	logger.Info("Start watching wlan...")
 	done := false
+	// changed devices get collected for a moment as netlink reports changes in bursts
+	changedDevices := map[string]bool{}
+	var queryChangedDevices <-chan time.Time
 	for !done {
+		// polling is only a safety net while wlan events are available
+		interval := WlanUpdateInterval
+		if s.wlanEventsActive.Load() {
+			interval = WlanEventPollInterval
+		}
 		select {
 		case <-s.ctx.Done():
 			done = true
 		case <-s.requestWlanUpdate:
 			s.queryWlan()
-		case <-time.After(WlanUpdateInterval):
+		case device := <-s.wlanEvents:
+			changedDevices[device] = true
+			if queryChangedDevices == nil {
+				queryChangedDevices = time.After(WlanEventDebounce)
+			}
+		case <-queryChangedDevices:
+			for device := range changedDevices {
+				s.queryWlanDevice(device)
+			}
+			changedDevices = map[string]bool{}
+			queryChangedDevices = nil
+		case <-time.After(interval):
 			s.queryWlan()
 		}
 	}
 	logger.Info("Stopped watching wlan")
 }
 
+// watchWlanEvents keeps listening to the wlan event source,
+// reconnecting after failures.
+func (s *Service) watchWlanEvents() {
+	logger.Info("Start watching wlan events...")
+	done := false
+	warned := false
+	for !done {
+		s.wlanEventsActive.Store(true)
+		err := s.wlanEventSource.WatchWlan(s.ctx, s.wlanEvents)
+		s.wlanEventsActive.Store(false)
+		if err != nil && !warned {
+			logger.Warn(fmt.Sprintf("Wlan events not available, polling wlan state: %v", err))
+			warned = true
+		} else if err != nil {
+			logger.Debug(fmt.Sprintf("Wlan events still not available: %v", err))
+		}
+		select {
+		case <-s.ctx.Done():
+			done = true
+		case <-time.After(WlanEventRetryInterval):
+		}
+	}
+	logger.Info("Stopped watching wlan events")
+}
+
 func (s *Service) queryWlan() {
 	logger.Debug("Query wlan")
-	if devices, err := getWlanDevices(); err == nil {
+	if devices, err := s.wlanBackend.GetWlanDevices(); err == nil {
 		if !slices.Equal(devices, s.wlanDevices) {
-			for _, d := range devices {
-				logger.Info(fmt.Sprintf("New wlan state: %s", d.String()))
-			}
-			s.wlanDevices = devices
-			s.publishEvents <- NewWlanStateChangedEvent(devices)
+			s.updateWlanDevices(devices)
 		}
 	}
 	logger.Debug("Queried wlan")
 }
 
+// queryWlanDevice only queries named device,
+// falling back to query all devices for devices we don't know yet.
+func (s *Service) queryWlanDevice(name string) {
+	logger.Debug(fmt.Sprintf("Query wlan device %s", name))
+	i := slices.IndexFunc(s.wlanDevices, func(d WlanDevice) bool { return d.Name == name })
+	if i < 0 {
+		s.queryWlan()
+		return
+	}
+	state, err := s.wlanBackend.GetWlanState(name)
+	if err != nil {
+		// the device may be gone
+		s.queryWlan()
+		return
+	}
+	device := WlanDevice{Name: name, State: state}
+	if state == WlanPowerOn {
+		if network, err := s.wlanBackend.GetWlanNetwork(name); err == nil {
+			device.Network = network
+		}
+	}
+	if device.Network == s.wlanDevices[i].Network {
+		device.Signal = s.wlanDevices[i].Signal
+	}
+	if device != s.wlanDevices[i] {
+		devices := CopyWlanDevices(s.wlanDevices)
+		devices[i] = device
+		s.updateWlanDevices(devices)
+	}
+	logger.Debug(fmt.Sprintf("Queried wlan device %s", name))
+}
+
+// updateWlanDevices publishes the changes of each device compared by name,
+// followed by the new state of all devices.
+func (s *Service) updateWlanDevices(devices []WlanDevice) {
+	s.stateMutex.Lock()
+	previousDevices := s.wlanDevices
+	s.wlanDevices = devices
+	s.stateMutex.Unlock()
+	for _, device := range devices {
+		i := slices.IndexFunc(previousDevices, func(d WlanDevice) bool { return d.Name == device.Name })
+		if i < 0 {
+			logger.Info(fmt.Sprintf("New wlan device: %s", device.String()))
+			s.publishEvents <- WlanDeviceAddedEvent{Device: device}
+		} else if device != previousDevices[i] {
+			logger.Info(fmt.Sprintf("New wlan state: %s", device.String()))
+			s.publishEvents <- WlanDeviceChangedEvent{Device: device, Previous: previousDevices[i]}
+		}
+	}
+	for _, device := range previousDevices {
+		if !slices.ContainsFunc(devices, func(d WlanDevice) bool { return d.Name == device.Name }) {
+			logger.Info(fmt.Sprintf("Removed wlan device: %s", device.Name))
+			s.publishEvents <- WlanDeviceRemovedEvent{Device: device}
+		}
+	}
+	s.publishEvents <- NewWlanStateChangedEvent(devices)
+}
+
 func (s *Service) GetWlanDevices() []WlanDevice {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
 	return CopyWlanDevices(s.wlanDevices)
 }
 
 func (s *Service) SetWlanState(device string, state WlanState) {
 	logger.Info(fmt.Sprintf("Setting WLAN device %s to %s", device, WlanStateToString(state)))
-	if setWlanState(device, state) == nil {
-		s.requestWlanUpdate <- true
+	if s.wlanBackend.SetWlanState(device, state) == nil {
+		// don't block subscribers calling this while handling an event
+		go func() {
+			select {
+			case s.requestWlanUpdate <- true:
+			case <-s.ctx.Done():
+			}
+		}()
+	}
+}
+
+func (s *Service) GetBluetoothState() BluetoothState {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	return s.bluetoothState
+}
+
+func (s *Service) watchBluetooth() {
+	logger.Info("Start watching bluetooth...")
+	done := false
+	for !done {
+		select {
+		case <-s.ctx.Done():
+			done = true
+		case <-s.requestBluetoothUpdate:
+			s.queryBluetooth()
+		case <-time.After(BluetoothUpdateInterval):
+			s.queryBluetooth()
+		}
+	}
+	logger.Info("Stopped watching bluetooth")
+}
+
+func (s *Service) queryBluetooth() {
+	logger.Debug("Query bluetooth")
+	if bluetoothState, err := s.bluetoothBackend.GetBluetoothState(); err == nil {
+		if bluetoothState != s.bluetoothState {
+			logger.Info(fmt.Sprintf("New bluetooth state: %s", BluetoothStateToString(bluetoothState)))
+			s.stateMutex.Lock()
+			s.bluetoothState = bluetoothState
+			s.stateMutex.Unlock()
+			s.publishEvents <- BluetoothStateChangedEvent{
+				BluetoothState: bluetoothState,
+			}
+		}
+	}
+	logger.Debug("Queried bluetooth")
+}
+
+func (s *Service) SetBluetoothState(state BluetoothState) {
+	if s.bluetoothBackend == nil {
+		return
+	}
+	logger.Info(fmt.Sprintf("Setting bluetooth to %s", BluetoothStateToString(state)))
+	if s.bluetoothBackend.SetBluetoothState(state) == nil {
+		// don't block subscribers calling this while handling an event
+		go func() {
+			select {
+			case s.requestBluetoothUpdate <- true:
+			case <-s.ctx.Done():
+			}
+		}()
+	}
+}
+
+func (s *Service) GetEthernetDevices() []EthernetDevice {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	return CopyEthernetDevices(s.ethernetDevices)
+}
+
+func (s *Service) watchEthernet() {
+	logger.Info("Start watching ethernet...")
+	done := false
+	for !done {
+		select {
+		case <-s.ctx.Done():
+			done = true
+		case <-time.After(EthernetUpdateInterval):
+			s.queryEthernet()
+		}
+	}
+	logger.Info("Stopped watching ethernet")
+}
+
+func (s *Service) queryEthernet() {
+	logger.Debug("Query ethernet")
+	if devices, err := s.ethernetBackend.GetEthernetDevices(); err == nil {
+		if !slices.Equal(devices, s.ethernetDevices) {
+			for _, d := range devices {
+				logger.Info(fmt.Sprintf("New ethernet state: %s", d.String()))
+			}
+			s.stateMutex.Lock()
+			s.ethernetDevices = devices
+			s.stateMutex.Unlock()
+			s.publishEvents <- NewEthernetStateChangedEvent(devices)
+		}
+	}
+	logger.Debug("Queried ethernet")
+}
+
+func (s *Service) GetPowerState() PowerState {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	return s.powerState
+}
+
+func (s *Service) watchPower() {
+	logger.Info("Start watching power...")
+	done := false
+	for !done {
+		select {
+		case <-s.ctx.Done():
+			done = true
+		case <-time.After(PowerUpdateInterval):
+			s.queryPower()
+		}
+	}
+	logger.Info("Stopped watching power")
+}
+
+func (s *Service) queryPower() {
+	logger.Debug("Query power")
+	if powerState, err := s.powerBackend.GetPowerState(); err == nil {
+		if powerState != s.powerState {
+			logger.Info(fmt.Sprintf("New power state: %s", powerState.String()))
+			s.stateMutex.Lock()
+			s.powerState = powerState
+			s.stateMutex.Unlock()
+			s.publishEvents <- PowerStateChangedEvent{
+				PowerState: powerState,
+			}
+		}
+	}
+	logger.Debug("Queried power")
+}
+
+// Notify shows a desktop notification, it is only logged without notifier.
+func (s *Service) Notify(title, message string) {
+	logger.Info(fmt.Sprintf("Notification %s: %s", title, message))
+	if s.notifier != nil {
+		s.notifier.Notify(title, message)
 	}
 }
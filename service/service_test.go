@@ -0,0 +1,231 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// togglingBackends is a system whose lid, radios, wired link and battery change on every query.
+type togglingBackends struct {
+	mutex   sync.Mutex
+	queries int
+}
+
+// next returns whether the state changed by the query is on.
+func (b *togglingBackends) next() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.queries++
+	return b.queries%2 == 0
+}
+
+func (b *togglingBackends) GetWlanDevices() ([]WlanDevice, error) {
+	state, _ := b.GetWlanState("wlan0")
+	return []WlanDevice{{Name: "wlan0", State: state}}, nil
+}
+
+func (b *togglingBackends) GetWlanState(device string) (WlanState, error) {
+	if b.next() {
+		return WlanPowerOn, nil
+	}
+	return WlanPowerOff, nil
+}
+
+func (b *togglingBackends) SetWlanState(device string, state WlanState) error {
+	return nil
+}
+
+func (b *togglingBackends) GetWlanNetwork(device string) (string, error) {
+	return "", nil
+}
+
+func (b *togglingBackends) GetLidState() (LidState, error) {
+	if b.next() {
+		return LidOpen, nil
+	}
+	return LidClosed, nil
+}
+
+func (b *togglingBackends) HasExternalDisplay() (bool, error) {
+	return b.next(), nil
+}
+
+func (b *togglingBackends) GetBluetoothState() (BluetoothState, error) {
+	if b.next() {
+		return BluetoothPowerOn, nil
+	}
+	return BluetoothPowerOff, nil
+}
+
+func (b *togglingBackends) SetBluetoothState(state BluetoothState) error {
+	return nil
+}
+
+func (b *togglingBackends) GetEthernetDevices() ([]EthernetDevice, error) {
+	if b.next() {
+		return []EthernetDevice{{Name: "eth0", Link: EthernetLinkUp}}, nil
+	}
+	return []EthernetDevice{{Name: "eth0", Link: EthernetLinkDown}}, nil
+}
+
+func (b *togglingBackends) GetPowerState() (PowerState, error) {
+	if b.next() {
+		return PowerState{Source: PowerSourceAC, Percentage: 80}, nil
+	}
+	return PowerState{Source: PowerSourceBattery, Percentage: 79}, nil
+}
+
+// shortPollIntervals changes the poll intervals once, they are never restored
+// as the watch goroutines of services may still read them after their test.
+var shortPollIntervals sync.Once
+
+// TestGettersWhileWatching reads the state while the watch goroutines change it,
+// run with -race to detect unguarded state.
+func TestGettersWhileWatching(t *testing.T) {
+	shortPollIntervals.Do(func() {
+		LidUpdateInterval, WlanUpdateInterval, BluetoothUpdateInterval, EthernetUpdateInterval, PowerUpdateInterval =
+			time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backends := &togglingBackends{}
+	s := NewService(ctx, Backends{Wlan: backends, Lid: backends, Bluetooth: backends, Ethernet: backends, Power: backends})
+	subscription := s.Subscripe()
+	events := 0
+	deadline := time.After(100 * time.Millisecond)
+	for done := false; !done; {
+		select {
+		case <-subscription.Updates():
+			events++
+		case <-deadline:
+			done = true
+		}
+		s.GetLidState()
+		s.IsClamshell()
+		s.GetWlanDevices()
+		s.GetBluetoothState()
+		s.GetEthernetDevices()
+		s.GetPowerState()
+	}
+	if events == 0 {
+		t.Errorf("no events published while watching")
+	}
+	go subscription.Unsubscribe()
+	for range subscription.Updates() {
+	}
+}
+
+// fakeWlanBackend serves the devices set by the test and records the queries.
+type fakeWlanBackend struct {
+	devices []WlanDevice
+	queries []string
+}
+
+func (b *fakeWlanBackend) GetWlanDevices() ([]WlanDevice, error) {
+	b.queries = append(b.queries, "devices")
+	return CopyWlanDevices(b.devices), nil
+}
+
+func (b *fakeWlanBackend) GetWlanState(device string) (WlanState, error) {
+	b.queries = append(b.queries, "state "+device)
+	for _, d := range b.devices {
+		if d.Name == device {
+			return d.State, nil
+		}
+	}
+	return WlanUnknown, fmt.Errorf("unknown device %s", device)
+}
+
+func (b *fakeWlanBackend) SetWlanState(device string, state WlanState) error {
+	return nil
+}
+
+func (b *fakeWlanBackend) GetWlanNetwork(device string) (string, error) {
+	b.queries = append(b.queries, "network "+device)
+	for _, d := range b.devices {
+		if d.Name == device {
+			return d.Network, nil
+		}
+	}
+	return "", fmt.Errorf("unknown device %s", device)
+}
+
+func TestQueryWlanDeviceOnlyQueriesChangedDevice(t *testing.T) {
+	backend := &fakeWlanBackend{devices: []WlanDevice{
+		{Name: "wlan0", State: WlanPowerOn, Network: "Office", Signal: -50},
+		{Name: "wlan1", State: WlanPowerOff},
+	}}
+	s := &Service{wlanBackend: backend, wlanDevices: CopyWlanDevices(backend.devices), publishEvents: make(chan interface{}, 10)}
+
+	// each step changes the backend, queries named device and tells the backend queries and published events
+	steps := []struct {
+		name    string
+		change  func()
+		device  string
+		queries []string
+		events  []interface{}
+	}{
+		{"unchanged", func() {}, "wlan1", []string{"state wlan1"}, nil},
+		{"associated", func() { backend.devices[1] = WlanDevice{Name: "wlan1", State: WlanPowerOn, Network: "Cafe"} },
+			"wlan1", []string{"state wlan1", "network wlan1"}, []interface{}{
+				WlanDeviceChangedEvent{Device: WlanDevice{Name: "wlan1", State: WlanPowerOn, Network: "Cafe"}, Previous: WlanDevice{Name: "wlan1", State: WlanPowerOff}},
+			}},
+		{"signal kept for same network", func() {}, "wlan0", []string{"state wlan0", "network wlan0"}, nil},
+		{"unknown device", func() { backend.devices = append(backend.devices, WlanDevice{Name: "wlan2", State: WlanPowerOff}) },
+			"wlan2", []string{"devices"}, []interface{}{WlanDeviceAddedEvent{Device: WlanDevice{Name: "wlan2", State: WlanPowerOff}}}},
+		{"device gone", func() { backend.devices = backend.devices[:2] },
+			"wlan2", []string{"state wlan2", "devices"}, []interface{}{WlanDeviceRemovedEvent{Device: WlanDevice{Name: "wlan2", State: WlanPowerOff}}}},
+	}
+	for _, step := range steps {
+		step.change()
+		backend.queries = nil
+		s.queryWlanDevice(step.device)
+		if !slices.Equal(backend.queries, step.queries) {
+			t.Errorf("%s: queries = %v, want %v", step.name, backend.queries, step.queries)
+		}
+		events := make([]interface{}, 0)
+		for len(s.publishEvents) > 0 {
+			if event := <-s.publishEvents; !isWlanStateChangedEvent(event) {
+				events = append(events, event)
+			}
+		}
+		if len(events) != len(step.events) {
+			t.Errorf("%s: published %v, want %v", step.name, events, step.events)
+			continue
+		}
+		for i := range events {
+			if events[i] != step.events[i] {
+				t.Errorf("%s: published %v, want %v", step.name, events[i], step.events[i])
+			}
+		}
+	}
+	if devices := s.GetWlanDevices(); devices[0].Signal != -50 {
+		t.Errorf("signal of unchanged network = %d, want -50", devices[0].Signal)
+	}
+}
+
+func isWlanStateChangedEvent(event interface{}) bool {
+	_, ok := event.(WlanStateChangedEvent)
+	return ok
+}
@@ -0,0 +1,42 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import "context"
+
+// SleepEvent is sent before the system goes to sleep and after it woke up again.
+type SleepEvent struct {
+	Sleeping bool
+}
+
+// SleepEventSource abstracts the platform specific way
+// to get notified about system sleep and wake.
+type SleepEventSource interface {
+	// WatchSleep delivers sleep events until given context is done or the source fails.
+	WatchSleep(ctx context.Context, events chan<- SleepEvent) error
+}
+
+// NewPlatformSleepEventSource returns the sleep event source for named platform, e.g. "darwin" or "linux".
+// Returns nil when the platform has no native source, the service then detects wake by time gaps.
+func NewPlatformSleepEventSource(platform string) SleepEventSource {
+	switch platform {
+	case "linux":
+		return NewLogindSleepEventSource()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// LogindSleepEventSource delivers sleep events on Linux
+// using the "PrepareForSleep" signal of systemd-logind.
+type LogindSleepEventSource struct{}
+
+func NewLogindSleepEventSource() *LogindSleepEventSource {
+	return &LogindSleepEventSource{}
+}
+
+func (l *LogindSleepEventSource) WatchSleep(ctx context.Context, events chan<- SleepEvent) error {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath("/org/freedesktop/login1"),
+		dbus.WithMatchInterface("org.freedesktop.login1.Manager"),
+		dbus.WithMatchMember("PrepareForSleep"),
+	); err != nil {
+		return err
+	}
+	signals := make(chan *dbus.Signal, 10)
+	conn.Signal(signals)
+
+	logger.Info("Listening for sleep events from logind")
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case signal, ok := <-signals:
+			if !ok {
+				return fmt.Errorf("system bus connection closed")
+			}
+			event, ok := parsePrepareForSleep(signal)
+			if !ok {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// parsePrepareForSleep returns the sleep event of a "PrepareForSleep" signal,
+// false for other signals.
+func parsePrepareForSleep(signal *dbus.Signal) (SleepEvent, bool) {
+	if signal.Name != "org.freedesktop.login1.Manager.PrepareForSleep" || len(signal.Body) < 1 {
+		return SleepEvent{}, false
+	}
+	sleeping, ok := signal.Body[0].(bool)
+	if !ok {
+		return SleepEvent{}, false
+	}
+	return SleepEvent{Sleeping: sleeping}, true
+}
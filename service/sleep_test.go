@@ -0,0 +1,182 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/manuel-koch/go-auto-wlan/utils/clocktest"
+)
+
+// waitForTimers waits until given clock has given number of pending timers.
+func waitForTimers(t *testing.T, clock *clocktest.FakeClock, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for clock.Pending() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("clock has %d pending timers, want %d", clock.Pending(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTimeGapSleepEventSource(t *testing.T) {
+	clock := clocktest.NewFakeClock(time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+	source := NewTimeGapSleepEventSource(5*time.Second, 10*time.Second, clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan SleepEvent, 10)
+	done := make(chan error)
+	go func() { done <- source.WatchSleep(ctx, events) }()
+	waitForTimers(t, clock, 1)
+
+	// each step jumps the clock right after a tick, so the next tick is late by the jump less the interval,
+	// the ticks after it make sure the late tick got handled
+	steps := []struct {
+		name  string
+		jump  time.Duration
+		wakes int
+	}{
+		{"regular ticks", 0, 0},
+		{"late within threshold", 15 * time.Second, 0},
+		{"late beyond threshold", 16 * time.Second, 1},
+		{"woke after an hour", time.Hour, 1},
+		{"regular ticks after wake", 0, 0},
+	}
+	for _, step := range steps {
+		clock.Jump(step.jump)
+		clock.Advance(0)
+		clock.Advance(5 * time.Second)
+		clock.Advance(5 * time.Second)
+		wakes := 0
+		for len(events) > 0 {
+			if event := <-events; event.Sleeping {
+				t.Errorf("%s: got sleep event, want only wake events", step.name)
+			}
+			wakes++
+		}
+		if wakes != step.wakes {
+			t.Errorf("%s: got %d wake events, want %d", step.name, wakes, step.wakes)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("WatchSleep() = %v, want nil after cancel", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("WatchSleep() didn't return after cancel")
+	}
+}
+
+func TestParsePrepareForSleep(t *testing.T) {
+	const prepareForSleep = "org.freedesktop.login1.Manager.PrepareForSleep"
+	tests := []struct {
+		name   string
+		signal dbus.Signal
+		want   SleepEvent
+		ok     bool
+	}{
+		{"going to sleep", dbus.Signal{Name: prepareForSleep, Body: []interface{}{true}}, SleepEvent{Sleeping: true}, true},
+		{"woke up", dbus.Signal{Name: prepareForSleep, Body: []interface{}{false}}, SleepEvent{Sleeping: false}, true},
+		{"other signal", dbus.Signal{Name: "org.freedesktop.login1.Manager.PrepareForShutdown", Body: []interface{}{true}}, SleepEvent{}, false},
+		{"without body", dbus.Signal{Name: prepareForSleep}, SleepEvent{}, false},
+		{"unexpected body", dbus.Signal{Name: prepareForSleep, Body: []interface{}{"yes"}}, SleepEvent{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := parsePrepareForSleep(&tt.signal)
+			if event != tt.want || ok != tt.ok {
+				t.Errorf("parsePrepareForSleep() = %v, %t, want %v, %t", event, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// fakeLidSensor reports the lid and external display set by the test.
+type fakeLidSensor struct {
+	lidState        LidState
+	externalDisplay bool
+	err             error
+}
+
+func (l *fakeLidSensor) GetLidState() (LidState, error) {
+	return l.lidState, l.err
+}
+
+func (l *fakeLidSensor) HasExternalDisplay() (bool, error) {
+	return l.externalDisplay, nil
+}
+
+func TestReconcileAfterWake(t *testing.T) {
+	tests := []struct {
+		name      string
+		before    LidState
+		clamshell bool
+		sensor    fakeLidSensor
+		want      []LidStateChangedEvent
+	}{
+		{"opened during sleep", LidClosed, false, fakeLidSensor{lidState: LidOpen},
+			[]LidStateChangedEvent{{LidState: LidOpen}}},
+		{"closed during sleep", LidOpen, false, fakeLidSensor{lidState: LidClosed},
+			[]LidStateChangedEvent{{LidState: LidClosed}}},
+		{"display connected during sleep", LidClosed, false, fakeLidSensor{lidState: LidClosed, externalDisplay: true},
+			[]LidStateChangedEvent{{LidState: LidClosed, Clamshell: true}}},
+		{"unchanged", LidClosed, false, fakeLidSensor{lidState: LidClosed},
+			[]LidStateChangedEvent{{LidState: LidClosed, Replayed: true}}},
+		{"unchanged clamshell", LidClosed, true, fakeLidSensor{lidState: LidClosed, externalDisplay: true},
+			[]LidStateChangedEvent{{LidState: LidClosed, Clamshell: true, Replayed: true}}},
+		{"lid unknown", LidOpen, false, fakeLidSensor{err: errors.New("no lid")}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			s := &Service{
+				ctx:               ctx,
+				lidSensor:         &tt.sensor,
+				lidState:          tt.before,
+				lidClamshell:      tt.clamshell,
+				publishEvents:     make(chan interface{}, 10),
+				requestWlanUpdate: make(chan interface{}),
+			}
+			s.reconcileAfterWake()
+
+			events := make([]LidStateChangedEvent, 0)
+			for len(s.publishEvents) > 0 {
+				events = append(events, (<-s.publishEvents).(LidStateChangedEvent))
+			}
+			if len(events) != len(tt.want) || (len(events) > 0 && events[0] != tt.want[0]) {
+				t.Errorf("published %v, want %v", events, tt.want)
+			}
+			if len(tt.want) > 0 && (s.GetLidState() != tt.want[0].LidState || s.IsClamshell() != tt.want[0].Clamshell) {
+				t.Errorf("lid after wake = %v (clamshell %t), want %v", s.GetLidState(), s.IsClamshell(), tt.want[0])
+			}
+			select {
+			case <-s.requestWlanUpdate:
+			case <-time.After(time.Second):
+				t.Errorf("wlan update not requested after wake")
+			}
+		})
+	}
+}
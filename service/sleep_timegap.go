@@ -0,0 +1,78 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/utils"
+)
+
+// TimeGapSleepEventSource detects system wake on any platform
+// by noticing gaps in the wall clock between regular ticks.
+// It can't tell when the system goes to sleep, only when it woke up.
+type TimeGapSleepEventSource struct {
+	interval  time.Duration
+	threshold time.Duration
+	clock     utils.Clock
+}
+
+// NewTimeGapSleepEventSource returns a sleep event source checking the clock every interval,
+// reporting a wake when a tick is late by more than given threshold.
+func NewTimeGapSleepEventSource(interval, threshold time.Duration, clock utils.Clock) *TimeGapSleepEventSource {
+	return &TimeGapSleepEventSource{interval: interval, threshold: threshold, clock: clock}
+}
+
+func (t *TimeGapSleepEventSource) WatchSleep(ctx context.Context, events chan<- SleepEvent) error {
+	// each tick schedules the next one and reports the time it got called,
+	// stripping the monotonic clock reading as it may not advance while the system sleeps
+	ticks := make(chan time.Time)
+	var tick func()
+	tick = func() {
+		if ctx.Err() != nil {
+			return
+		}
+		now := t.clock.Now().Round(0)
+		t.clock.AfterFunc(t.interval, tick)
+		select {
+		case ticks <- now:
+		case <-ctx.Done():
+		}
+	}
+
+	last := t.clock.Now().Round(0)
+	t.clock.AfterFunc(t.interval, tick)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticks:
+			gap := now.Sub(last)
+			last = now
+			if gap > t.interval+t.threshold {
+				logger.Debug(fmt.Sprintf("Clock jumped by %s, assuming system woke up", gap))
+				select {
+				case events <- SleepEvent{Sleeping: false}:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+	}
+}
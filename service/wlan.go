@@ -17,12 +17,10 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"os/exec"
-	"regexp"
-	"strings"
-
-	"github.com/manuel-koch/go-auto-wlan/utils"
 )
 
 type WlanState int
@@ -31,12 +29,68 @@ const (
 	WlanUnknown  WlanState = iota
 	WlanPowerOn  WlanState = iota
 	WlanPowerOff WlanState = iota
+	// WlanHardBlocked is a radio switched off by a hardware switch,
+	// it can't be powered on by software.
+	WlanHardBlocked WlanState = iota
 )
 
 type WlanDevice struct {
 	Name    string
 	State   WlanState
 	Network string
+	// Signal is the strength of the connection in dBm, zero if unknown.
+	Signal int
+}
+
+// WlanBackend abstracts the platform specific way
+// to query and control WLAN devices.
+type WlanBackend interface {
+	// GetWlanDevices returns all WLAN devices including their power state and network.
+	GetWlanDevices() ([]WlanDevice, error)
+	// GetWlanState returns the power state of named device.
+	GetWlanState(device string) (WlanState, error)
+	// SetWlanState switches the power of named device.
+	SetWlanState(device string, state WlanState) error
+	// GetWlanNetwork returns the network named device is connected to, if any.
+	GetWlanNetwork(device string) (string, error)
+}
+
+// WlanEventSource abstracts the platform specific way
+// to get notified about changes of WLAN devices as they happen.
+type WlanEventSource interface {
+	// WatchWlan delivers the names of changed WLAN devices
+	// until given context is done or the source fails.
+	WatchWlan(ctx context.Context, devices chan<- string) error
+}
+
+// NewPlatformWlanEventSource returns the WLAN event source for named platform, e.g. "darwin" or "linux".
+// Returns nil when the platform only supports polling.
+func NewPlatformWlanEventSource(platform string) WlanEventSource {
+	switch platform {
+	case "linux":
+		return newPlatformNetlinkWlanEventSource()
+	default:
+		return nil
+	}
+}
+
+// NewPlatformWlanBackend returns the WLAN backend for named platform, e.g. "darwin" or "linux".
+func NewPlatformWlanBackend(platform string, runner CommandRunner) WlanBackend {
+	switch platform {
+	case "linux":
+		if _, err := exec.LookPath("nmcli"); err == nil {
+			return NewNmcliWlanBackend(runner)
+		}
+		if _, err := exec.LookPath("iwctl"); err == nil {
+			return NewIwdWlanBackend(runner)
+		}
+		if _, err := os.Stat(WpaSupplicantCtrlDir); err == nil {
+			return NewWpaSupplicantWlanBackend(WpaSupplicantCtrlDir)
+		}
+		return NewRfkillWlanBackend("/")
+	default:
+		return NewNetworksetupWlanBackend(runner)
+	}
 }
 
 type InvalidWlanStateError struct {
@@ -47,9 +101,19 @@ func (e InvalidWlanStateError) Error() string {
 	return fmt.Sprintf("Invalid wlan state: %d (%s)", e.state, WlanStateToString(e.state))
 }
 
+type WlanHardBlockedError struct {
+	device string
+}
+
+func (e WlanHardBlockedError) Error() string {
+	return fmt.Sprintf("Wlan device %s is blocked by hardware switch", e.device)
+}
+
 func (d *WlanDevice) String() string {
 	s := fmt.Sprintf("%s is %s", d.Name, WlanStateToString(d.State))
-	if len(d.Network) > 0 {
+	if len(d.Network) > 0 && d.Signal != 0 {
+		s += fmt.Sprintf(" (%s, %d dBm)", d.Network, d.Signal)
+	} else if len(d.Network) > 0 {
 		s += fmt.Sprintf(" (%s)", d.Network)
 	}
 	return s
@@ -61,6 +125,8 @@ func WlanStateToString(state WlanState) string {
 		return "on"
 	case WlanPowerOff:
 		return "off"
+	case WlanHardBlocked:
+		return "hard blocked"
 	default:
 		return "unknown"
 	}
@@ -71,130 +137,3 @@ func CopyWlanDevices(devices []WlanDevice) []WlanDevice {
 	copy(copyDevices, devices)
 	return copyDevices
 }
-
-func getWlanDevices() ([]WlanDevice, error) {
-	logger.Debug("Searching wlan devices...")
-
-	devices := make([]WlanDevice, 0)
-
-	cmd := exec.Command("networksetup", "-listallhardwareports")
-	if outputBytes, err := cmd.Output(); err != nil {
-		logger.Error(fmt.Sprintf("Failed to get network hardware ports: %v", err))
-		return devices, err
-	} else {
-		// merge non-empty lines into one line
-		outputStr := string(outputBytes)
-		mergeLinesRe := regexp.MustCompile("(\\S+)\\n")
-		outputStr = mergeLinesRe.ReplaceAllString(outputStr, "$1 ")
-
-		wifiRe := regexp.MustCompile("Hardware Port:\\s+Wi-Fi")
-		deviceRe := regexp.MustCompile("Device:\\s+(?P<name>\\S+)")
-
-		lines := strings.Split(outputStr, "\n")
-		for _, line := range lines {
-			wifiMatch := utils.MatchNamedExpression(wifiRe, line)
-			if wifiMatch != nil {
-				deviceMatch := utils.MatchNamedExpression(deviceRe, line)
-				if deviceMatch != nil {
-					deviceName := deviceMatch["name"]
-					if state, err := getWlanState(deviceName); err == nil {
-						device := WlanDevice{Name: deviceName, State: state}
-						if device.State == WlanPowerOn {
-							if network, err := getWlanNetwork(deviceName); err == nil {
-								device.Network = network
-							}
-						}
-						devices = append(devices, device)
-						logger.Debug(fmt.Sprintf("Found wlan device %s", device.String()))
-					}
-				}
-			}
-		}
-	}
-
-	return devices, nil
-}
-
-func getWlanState(device string) (WlanState, error) {
-	cmd := exec.Command("networksetup", "-getairportpower", device)
-	if output, err := cmd.Output(); err != nil {
-		logger.Error(fmt.Sprintf("Failed to get network airport power: %v", err))
-		return WlanUnknown, err
-	} else {
-		stateRe := regexp.MustCompile(fmt.Sprintf("Wi-Fi\\s+Power\\s+\\(%s\\):\\s+(?P<state>\\S+)", device))
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			stateMatch := utils.MatchNamedExpression(stateRe, line)
-			if stateMatch != nil {
-				switch strings.ToLower(stateMatch["state"]) {
-				case "on":
-					{
-						return WlanPowerOn, nil
-					}
-				case "off":
-					{
-						return WlanPowerOff, nil
-					}
-				}
-			}
-		}
-		return WlanUnknown, nil
-	}
-}
-
-func setWlanState(device string, state WlanState) error {
-	var power string
-	switch state {
-	case WlanPowerOn:
-		power = "on"
-	case WlanPowerOff:
-		power = "off"
-	default:
-		return InvalidWlanStateError{state: WlanUnknown}
-	}
-	cmd := exec.Command("networksetup", "-setairportpower", device, power)
-	if _, err := cmd.Output(); err != nil {
-		logger.Error(fmt.Sprintf("Failed to set network airport power: %v", err))
-		return err
-	}
-	return nil
-}
-
-func getWlanNetwork(device string) (string, error) {
-	// Newer versions of MacOS (Sequoia) don't seem to return useful information
-	// from the "networksetup -getairportnetwork <DEVICE>" call.
-	// Even when connected to Wifi, it just reports "You are not associated with an AirPort network.".
-	// Using alternative command "ipconfig getsummary <DEVICE>" if the former doesn't work.
-
-	cmd := exec.Command("networksetup", "-getairportnetwork", device)
-	if output, err := cmd.Output(); err != nil {
-		logger.Error(fmt.Sprintf("Failed to get network airport network: %v", err))
-	} else {
-		networkRe := regexp.MustCompile("Current\\s+Wi-Fi\\s+Network:\\s+(?P<network>.+)\\s*")
-		outputStr := string(output)
-		lines := strings.Split(outputStr, "\n")
-		for _, line := range lines {
-			networkMatch := utils.MatchNamedExpression(networkRe, line)
-			if networkMatch != nil {
-				return networkMatch["network"], nil
-			}
-		}
-	}
-
-	cmd = exec.Command("ipconfig", "getsummary", device)
-	if output, err := cmd.Output(); err != nil {
-		logger.Error(fmt.Sprintf("Failed to get ipconfig summary: %v", err))
-	} else {
-		networkRe := regexp.MustCompile("^\\s*SSID\\s+:\\s+(?P<ssid>.+)\\s*")
-		outputStr := string(output)
-		lines := strings.Split(outputStr, "\n")
-		for _, line := range lines {
-			networkMatch := utils.MatchNamedExpression(networkRe, line)
-			if networkMatch != nil {
-				return networkMatch["ssid"], nil
-			}
-		}
-	}
-
-	return "", nil
-}
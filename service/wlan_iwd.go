@@ -0,0 +1,174 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// IwdWlanBackend controls WLAN devices on Linux
+// using the iwd command line client "iwctl".
+type IwdWlanBackend struct {
+	runner CommandRunner
+}
+
+// ansiEscapeRe matches the ANSI escape sequences iwctl uses to colour its tables.
+var ansiEscapeRe = regexp.MustCompile("\x1b(\\[[0-9;?]*[ -/]*[@-~]|\\][^\x07\x1b]*(\x07|\x1b\\\\)|[@-Z\\\\-_])")
+
+func NewIwdWlanBackend(runner CommandRunner) *IwdWlanBackend {
+	return &IwdWlanBackend{runner: runner}
+}
+
+func (b *IwdWlanBackend) GetWlanDevices() ([]WlanDevice, error) {
+	logger.Debug("Searching wlan devices...")
+
+	devices := make([]WlanDevice, 0)
+
+	rows, err := b.listDevices()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get iwd devices: %v", err))
+		return devices, err
+	}
+	for _, row := range rows {
+		device := WlanDevice{Name: row["Name"], State: iwdPowerToWlanState(row["Powered"])}
+		if device.State == WlanPowerOn {
+			if network, err := b.GetWlanNetwork(device.Name); err == nil {
+				device.Network = network
+			}
+		}
+		devices = append(devices, device)
+		logger.Debug(fmt.Sprintf("Found wlan device %s", device.String()))
+	}
+
+	return devices, nil
+}
+
+func (b *IwdWlanBackend) GetWlanState(device string) (WlanState, error) {
+	rows, err := b.listDevices()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get iwd devices: %v", err))
+		return WlanUnknown, err
+	}
+	for _, row := range rows {
+		if row["Name"] == device {
+			return iwdPowerToWlanState(row["Powered"]), nil
+		}
+	}
+	return WlanUnknown, nil
+}
+
+func (b *IwdWlanBackend) SetWlanState(device string, state WlanState) error {
+	var power string
+	switch state {
+	case WlanPowerOn:
+		power = "on"
+	case WlanPowerOff:
+		power = "off"
+	default:
+		return InvalidWlanStateError{state: state}
+	}
+	if _, err := b.runner.Output("iwctl", "device", device, "set-property", "Powered", power); err != nil {
+		logger.Error(fmt.Sprintf("Failed to set iwd device power: %v", err))
+		return err
+	}
+	return nil
+}
+
+func (b *IwdWlanBackend) GetWlanNetwork(device string) (string, error) {
+	if output, err := b.runner.Output("iwctl", "station", device, "show"); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get iwd station: %v", err))
+		return "", err
+	} else {
+		for _, row := range parseIwctlTable(string(output)) {
+			if row["Property"] == "Connected network" {
+				return row["Value"], nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func (b *IwdWlanBackend) listDevices() ([]map[string]string, error) {
+	output, err := b.runner.Output("iwctl", "device", "list")
+	if err != nil {
+		return nil, err
+	}
+	return parseIwctlTable(string(output)), nil
+}
+
+func iwdPowerToWlanState(power string) WlanState {
+	switch strings.ToLower(power) {
+	case "on":
+		return WlanPowerOn
+	case "off":
+		return WlanPowerOff
+	default:
+		return WlanUnknown
+	}
+}
+
+// parseIwctlTable parses a table printed by iwctl into one map per row,
+// keyed by the column names of the table header.
+// iwctl prints a title, a separator line, the header, another separator line
+// and then the rows, all with fixed column widths.
+func parseIwctlTable(output string) []map[string]string {
+	output = ansiEscapeRe.ReplaceAllString(output, "")
+
+	type column struct {
+		name  string
+		start int
+	}
+	columns := make([]column, 0)
+	rows := make([]map[string]string, 0)
+	separators := 0
+
+	headerRe := regexp.MustCompile("\\S+")
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(strings.TrimSpace(line)) > 0 && len(strings.Trim(line, "- ")) == 0 {
+			separators++
+			continue
+		}
+		runes := []rune(line)
+		switch {
+		case separators == 1 && len(columns) == 0:
+			for _, loc := range headerRe.FindAllStringIndex(line, -1) {
+				columns = append(columns, column{
+					name:  line[loc[0]:loc[1]],
+					start: len([]rune(line[:loc[0]])),
+				})
+			}
+		case separators >= 2 && len(columns) > 0 && len(strings.TrimSpace(line)) > 0:
+			row := map[string]string{}
+			for i, col := range columns {
+				end := len(runes)
+				if i+1 < len(columns) && columns[i+1].start < end {
+					end = columns[i+1].start
+				}
+				if col.start < end {
+					row[col.name] = strings.TrimSpace(string(runes[col.start:end]))
+				} else {
+					row[col.name] = ""
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,118 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeCommandRunner serves canned output by command line and remembers the commands run.
+type fakeCommandRunner struct {
+	outputs map[string]string
+	run     []string
+}
+
+func (r *fakeCommandRunner) Output(name string, args ...string) ([]byte, error) {
+	argv := append([]string{name}, args...)
+	r.run = append(r.run, strings.Join(argv, " "))
+	if output, ok := r.outputs[strings.Join(argv, " ")]; ok {
+		return []byte(output), nil
+	}
+	return nil, CommandNotRecordedError{Argv: argv}
+}
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestParseIwctlTable(t *testing.T) {
+	rows := parseIwctlTable(readFixture(t, "iwctl-device-list.txt"))
+	want := []map[string]string{
+		{"Name": "wlan0", "Address": "aa:bb:cc:dd:ee:ff", "Powered": "on", "Adapter": "phy0", "Mode": "station"},
+		{"Name": "wlan1", "Address": "11:22:33:44:55:66", "Powered": "off", "Adapter": "phy1", "Mode": "station"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("parseIwctlTable() = %v, want %v", rows, want)
+	}
+	for i := range rows {
+		for key, value := range want[i] {
+			if rows[i][key] != value {
+				t.Errorf("row %d column %s = %q, want %q", i, key, rows[i][key], value)
+			}
+		}
+	}
+
+	rows = parseIwctlTable(readFixture(t, "iwctl-station-wlan0-show.txt"))
+	properties := map[string]string{}
+	for _, row := range rows {
+		properties[row["Property"]] = row["Value"]
+	}
+	for property, value := range map[string]string{
+		"State":             "connected",
+		"Connected network": "My Café Net",
+		"RSSI":              "-52 dBm",
+	} {
+		if properties[property] != value {
+			t.Errorf("station property %s = %q, want %q", property, properties[property], value)
+		}
+	}
+
+	if rows := parseIwctlTable(""); len(rows) != 0 {
+		t.Errorf("parseIwctlTable() of empty output = %v, want no rows", rows)
+	}
+}
+
+func TestIwdWlanBackend(t *testing.T) {
+	runner := &fakeCommandRunner{outputs: map[string]string{
+		"iwctl device list":                          readFixture(t, "iwctl-device-list.txt"),
+		"iwctl station wlan0 show":                   readFixture(t, "iwctl-station-wlan0-show.txt"),
+		"iwctl device wlan1 set-property Powered on": "",
+	}}
+	backend := NewIwdWlanBackend(runner)
+
+	devices, err := backend.GetWlanDevices()
+	if err != nil {
+		t.Fatalf("GetWlanDevices() error = %v", err)
+	}
+	want := []WlanDevice{
+		{Name: "wlan0", State: WlanPowerOn, Network: "My Café Net"},
+		{Name: "wlan1", State: WlanPowerOff},
+	}
+	if !slices.Equal(devices, want) {
+		t.Fatalf("GetWlanDevices() = %v, want %v", devices, want)
+	}
+
+	if state, err := backend.GetWlanState("wlan1"); err != nil || state != WlanPowerOff {
+		t.Errorf("GetWlanState() = %s, %v, want off", WlanStateToString(state), err)
+	}
+
+	if err := backend.SetWlanState("wlan1", WlanPowerOn); err != nil {
+		t.Fatalf("SetWlanState() error = %v", err)
+	}
+	if last := runner.run[len(runner.run)-1]; last != "iwctl device wlan1 set-property Powered on" {
+		t.Errorf("SetWlanState() ran %q", last)
+	}
+}
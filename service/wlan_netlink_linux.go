@@ -0,0 +1,363 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+
+//go:build linux
+
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	netlinkReadTimeout = time.Second
+
+	// rtnetlink multicast groups, see linux/rtnetlink.h
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv6IfAddr = 0x100
+
+	// generic netlink constants, see linux/genetlink.h and linux/nl80211.h
+	genlIdCtrl              = 0x10
+	genlHeaderLen           = 4
+	ctrlCmdGetFamily        = 3
+	ctrlAttrFamilyId        = 1
+	ctrlAttrFamilyName      = 2
+	ctrlAttrMcastGroups     = 7
+	ctrlAttrMcastGroupName  = 1
+	ctrlAttrMcastGroupId    = 2
+	nl80211AttrIfIndex      = 3
+	nl80211MlmeGroup        = "mlme"
+	solNetlink              = 270
+	netlinkAddMembership    = 1
+	netlinkAttrTypeMask     = 0x3fff
+	netlinkAttrHeaderLength = 4
+)
+
+// NetlinkWlanEventSource delivers WLAN changes on Linux
+// by subscribing to rtnetlink link and address changes
+// and to nl80211 association changes where available.
+type NetlinkWlanEventSource struct{}
+
+func NewNetlinkWlanEventSource() *NetlinkWlanEventSource {
+	return &NetlinkWlanEventSource{}
+}
+
+func newPlatformNetlinkWlanEventSource() WlanEventSource {
+	return NewNetlinkWlanEventSource()
+}
+
+func (n *NetlinkWlanEventSource) WatchWlan(ctx context.Context, devices chan<- string) error {
+	routeFd, err := openNetlinkSocket(syscall.NETLINK_ROUTE,
+		rtmgrpLink|rtmgrpIPv4IfAddr|rtmgrpIPv6IfAddr)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to rtnetlink: %v", err)
+	}
+
+	// stop all readers when the first one fails and wait for them before closing
+	// their sockets, the number of a closed socket may get reused by other sockets
+	ctx, cancel := context.WithCancel(ctx)
+	var readers sync.WaitGroup
+	fds := []int{routeFd}
+	defer func() {
+		cancel()
+		readers.Wait()
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+	}()
+
+	errs := make(chan error, 2)
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		errs <- readNetlinkEvents(ctx, routeFd, parseRouteEvent, devices)
+	}()
+
+	if genlFd, err := openNl80211Socket(); err != nil {
+		logger.Info(fmt.Sprintf("Not watching nl80211 events: %v", err))
+	} else {
+		fds = append(fds, genlFd)
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			errs <- readNetlinkEvents(ctx, genlFd, parseNl80211Event, devices)
+		}()
+	}
+
+	logger.Info("Listening for wlan events via netlink")
+	return <-errs
+}
+
+func openNetlinkSocket(protocol int, groups uint32) (int, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, protocol)
+	if err != nil {
+		return -1, err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups}); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	// wake up regularly to check whether we are done
+	timeout := syscall.NsecToTimeval(netlinkReadTimeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// openNl80211Socket returns a generic netlink socket
+// subscribed to the nl80211 multicast group for association changes.
+func openNl80211Socket() (int, error) {
+	fd, err := openNetlinkSocket(syscall.NETLINK_GENERIC, 0)
+	if err != nil {
+		return -1, err
+	}
+	groupId, err := resolveNl80211MlmeGroup(fd)
+	if err == nil {
+		err = syscall.SetsockoptInt(fd, solNetlink, netlinkAddMembership, int(groupId))
+	}
+	if err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// resolveNl80211MlmeGroup asks the generic netlink controller
+// for the id of the nl80211 "mlme" multicast group.
+func resolveNl80211MlmeGroup(fd int) (uint32, error) {
+	familyName := append([]byte("nl80211"), 0)
+	attr := make([]byte, netlinkAttrHeaderLength+netlinkAlign(len(familyName)))
+	binary.NativeEndian.PutUint16(attr[0:2], uint16(netlinkAttrHeaderLength+len(familyName)))
+	binary.NativeEndian.PutUint16(attr[2:4], ctrlAttrFamilyName)
+	copy(attr[netlinkAttrHeaderLength:], familyName)
+
+	request := make([]byte, syscall.NLMSG_HDRLEN+genlHeaderLen+len(attr))
+	binary.NativeEndian.PutUint32(request[0:4], uint32(len(request)))
+	binary.NativeEndian.PutUint16(request[4:6], genlIdCtrl)
+	binary.NativeEndian.PutUint16(request[6:8], syscall.NLM_F_REQUEST)
+	binary.NativeEndian.PutUint32(request[8:12], 1)
+	request[syscall.NLMSG_HDRLEN] = ctrlCmdGetFamily
+	request[syscall.NLMSG_HDRLEN+1] = 1
+	copy(request[syscall.NLMSG_HDRLEN+genlHeaderLen:], attr)
+
+	if err := syscall.Sendto(fd, request, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, os.Getpagesize())
+	n, _, err := syscall.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return 0, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return 0, err
+	}
+	for _, msg := range msgs {
+		if msg.Header.Type == syscall.NLMSG_ERROR {
+			return 0, errors.New("nl80211 not available")
+		}
+		if msg.Header.Type != genlIdCtrl || len(msg.Data) < genlHeaderLen {
+			continue
+		}
+		attrs := parseNetlinkAttrs(msg.Data[genlHeaderLen:])
+		for _, group := range parseNetlinkAttrList(attrs[ctrlAttrMcastGroups]) {
+			groupAttrs := parseNetlinkAttrs(group)
+			name := string(groupAttrs[ctrlAttrMcastGroupName])
+			if len(name) > 0 && name[:len(name)-1] == nl80211MlmeGroup && len(groupAttrs[ctrlAttrMcastGroupId]) >= 4 {
+				return binary.NativeEndian.Uint32(groupAttrs[ctrlAttrMcastGroupId]), nil
+			}
+		}
+	}
+	return 0, errors.New("nl80211 mlme multicast group not found")
+}
+
+// netlinkEvent is the interface a netlink message refers to,
+// by name when the message contains it, by index otherwise.
+type netlinkEvent struct {
+	name  string
+	index int
+}
+
+// readNetlinkEvents reads netlink messages from given socket until given context is done,
+// delivering the names of the WLAN devices they refer to.
+func readNetlinkEvents(ctx context.Context, fd int, parse func(msg syscall.NetlinkMessage) (netlinkEvent, bool), devices chan<- string) error {
+	buf := make([]byte, 16*os.Getpagesize())
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		events, err := parseNetlinkEvents(buf[:n], parse)
+		if err != nil {
+			logger.Debug(fmt.Sprintf("Failed to parse netlink message: %v", err))
+			continue
+		}
+		for _, event := range events {
+			device := event.wlanDevice("/", interfaceNameByIndex)
+			if len(device) == 0 {
+				continue
+			}
+			logger.Debug(fmt.Sprintf("Got netlink event for %s", device))
+			select {
+			case devices <- device:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// parseNetlinkEvents parses the netlink messages of given buffer with given function,
+// returns the interfaces of the messages it recognized.
+func parseNetlinkEvents(b []byte, parse func(msg syscall.NetlinkMessage) (netlinkEvent, bool)) ([]netlinkEvent, error) {
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]netlinkEvent, 0, len(msgs))
+	for _, msg := range msgs {
+		if event, ok := parse(msg); ok {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// parseRouteEvent returns the interface of a rtnetlink link or address message.
+func parseRouteEvent(msg syscall.NetlinkMessage) (netlinkEvent, bool) {
+	switch msg.Header.Type {
+	case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+		if len(msg.Data) < syscall.SizeofIfInfomsg {
+			return netlinkEvent{}, false
+		}
+		if attrs, err := syscall.ParseNetlinkRouteAttr(&msg); err == nil {
+			for _, attr := range attrs {
+				if attr.Attr.Type == syscall.IFLA_IFNAME && len(attr.Value) > 0 {
+					return netlinkEvent{name: string(attr.Value[:len(attr.Value)-1])}, true
+				}
+			}
+		}
+		return netlinkEvent{index: int(int32(binary.NativeEndian.Uint32(msg.Data[4:8])))}, true
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		if len(msg.Data) < syscall.SizeofIfAddrmsg {
+			return netlinkEvent{}, false
+		}
+		return netlinkEvent{index: int(binary.NativeEndian.Uint32(msg.Data[4:8]))}, true
+	default:
+		return netlinkEvent{}, false
+	}
+}
+
+// parseNl80211Event returns the interface of a nl80211 message.
+func parseNl80211Event(msg syscall.NetlinkMessage) (netlinkEvent, bool) {
+	if len(msg.Data) < genlHeaderLen {
+		return netlinkEvent{}, false
+	}
+	attrs := parseNetlinkAttrs(msg.Data[genlHeaderLen:])
+	if ifIndex, ok := attrs[nl80211AttrIfIndex]; ok && len(ifIndex) >= 4 {
+		return netlinkEvent{index: int(binary.NativeEndian.Uint32(ifIndex))}, true
+	}
+	return netlinkEvent{}, false
+}
+
+// wlanDevice returns the name of the WLAN device the event refers to, empty for other interfaces,
+// looking up interfaces by index with given function and in sysfs below given root path.
+func (e netlinkEvent) wlanDevice(root string, nameByIndex func(index int) string) string {
+	name := e.name
+	if len(name) == 0 {
+		name = nameByIndex(e.index)
+	}
+	if len(name) == 0 || !isWlanInterface(root, name) {
+		return ""
+	}
+	return name
+}
+
+func interfaceNameByIndex(index int) string {
+	if iface, err := net.InterfaceByIndex(index); err == nil {
+		return iface.Name
+	}
+	return ""
+}
+
+// isWlanInterface returns whether named interface is a WLAN device
+// according to sysfs below given root path, interfaces that are gone already
+// are reported as WLAN device so the removal gets noticed.
+func isWlanInterface(root, name string) bool {
+	path := filepath.Join(root, "sys", "class", "net", name)
+	if _, err := os.Stat(path); err != nil {
+		return true
+	}
+	for _, marker := range []string{"wireless", "phy80211"} {
+		if _, err := os.Stat(filepath.Join(path, marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetlinkAttrs parses netlink attributes into a map by attribute type.
+func parseNetlinkAttrs(b []byte) map[uint16][]byte {
+	attrs := map[uint16][]byte{}
+	for len(b) >= netlinkAttrHeaderLength {
+		length := int(binary.NativeEndian.Uint16(b[0:2]))
+		kind := binary.NativeEndian.Uint16(b[2:4]) & netlinkAttrTypeMask
+		if length < netlinkAttrHeaderLength || length > len(b) {
+			break
+		}
+		attrs[kind] = b[netlinkAttrHeaderLength:length]
+		b = b[min(netlinkAlign(length), len(b)):]
+	}
+	return attrs
+}
+
+// parseNetlinkAttrList parses a nested list of netlink attributes, ignoring their types.
+func parseNetlinkAttrList(b []byte) [][]byte {
+	list := make([][]byte, 0)
+	for len(b) >= netlinkAttrHeaderLength {
+		length := int(binary.NativeEndian.Uint16(b[0:2]))
+		if length < netlinkAttrHeaderLength || length > len(b) {
+			break
+		}
+		list = append(list, b[netlinkAttrHeaderLength:length])
+		b = b[min(netlinkAlign(length), len(b)):]
+	}
+	return list
+}
+
+func netlinkAlign(length int) int {
+	return (length + syscall.NLMSG_ALIGNTO - 1) & ^(syscall.NLMSG_ALIGNTO - 1)
+}
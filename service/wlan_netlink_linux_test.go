@@ -0,0 +1,184 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+
+//go:build linux
+
+package service
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// readHexFixture returns the bytes of a hex dump in testdata, e.g. a captured netlink message.
+func readHexFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(readFixture(t, name)), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// skipOnBigEndian skips tests of netlink messages captured on a little endian system.
+func skipOnBigEndian(t *testing.T) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("netlink messages were captured on a little endian system")
+	}
+}
+
+// netlinkMessage returns a netlink message of given type and payload.
+func netlinkMessage(kind uint16, payload []byte) []byte {
+	msg := make([]byte, syscall.NLMSG_HDRLEN+netlinkAlign(len(payload)))
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(syscall.NLMSG_HDRLEN+len(payload)))
+	binary.NativeEndian.PutUint16(msg[4:6], kind)
+	copy(msg[syscall.NLMSG_HDRLEN:], payload)
+	return msg
+}
+
+// netlinkAttr returns a netlink attribute of given type and value.
+func netlinkAttr(kind uint16, value []byte) []byte {
+	attr := make([]byte, netlinkAttrHeaderLength+netlinkAlign(len(value)))
+	binary.NativeEndian.PutUint16(attr[0:2], uint16(netlinkAttrHeaderLength+len(value)))
+	binary.NativeEndian.PutUint16(attr[2:4], kind)
+	copy(attr[netlinkAttrHeaderLength:], value)
+	return attr
+}
+
+func joinBytes(parts ...[]byte) []byte {
+	joined := make([]byte, 0)
+	for _, part := range parts {
+		joined = append(joined, part...)
+	}
+	return joined
+}
+
+func netlinkUint32(value uint32) []byte {
+	return binary.NativeEndian.AppendUint32(nil, value)
+}
+
+func TestParseRouteEvents(t *testing.T) {
+	skipOnBigEndian(t)
+	linkUp := readHexFixture(t, "rtnetlink-link-up.hex")
+	ipv6AddrNew := readHexFixture(t, "rtnetlink-ipv6-addr-new.hex")
+	// a neighbour change of the same interface, not watched
+	neighbour := slices.Clone(ipv6AddrNew)
+	binary.NativeEndian.PutUint16(neighbour[4:6], syscall.RTM_NEWNEIGH)
+
+	tests := []struct {
+		name string
+		b    []byte
+		want []netlinkEvent
+	}{
+		{"link up", linkUp, []netlinkEvent{{name: "ifb0"}}},
+		{"link down", readHexFixture(t, "rtnetlink-link-down.hex"), []netlinkEvent{{name: "ifb0"}}},
+		{"ipv4 address added", readHexFixture(t, "rtnetlink-ipv4-addr-new.hex"), []netlinkEvent{{index: 2}}},
+		{"ipv4 address removed", readHexFixture(t, "rtnetlink-ipv4-addr-del.hex"), []netlinkEvent{{index: 2}}},
+		{"ipv6 address added", ipv6AddrNew, []netlinkEvent{{index: 2}}},
+		{"several messages", joinBytes(linkUp, neighbour, ipv6AddrNew), []netlinkEvent{{name: "ifb0"}, {index: 2}}},
+		{"other message", neighbour, []netlinkEvent{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := parseNetlinkEvents(tt.b, parseRouteEvent)
+			if err != nil {
+				t.Fatalf("parseNetlinkEvents() failed: %v", err)
+			}
+			if !slices.Equal(events, tt.want) {
+				t.Errorf("parseNetlinkEvents() = %v, want %v", events, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseNetlinkEvents(linkUp[:100], parseRouteEvent); err == nil {
+		t.Errorf("parseNetlinkEvents() of truncated message succeeded")
+	}
+}
+
+func TestParseNl80211Events(t *testing.T) {
+	const (
+		nl80211CmdConnect    = 46
+		nl80211CmdDisconnect = 48
+		nl80211CmdRegChange  = 36
+		nl80211AttrWiphy     = 1
+		nl80211AttrMac       = 6
+		nl80211AttrRegAlpha2 = 33
+		nl80211FamilyId      = 0x1c
+	)
+	genlMessage := func(cmd byte, attrs ...[]byte) []byte {
+		return netlinkMessage(nl80211FamilyId, joinBytes(append([][]byte{{cmd, 1, 0, 0}}, attrs...)...))
+	}
+	mac := []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+
+	tests := []struct {
+		name string
+		b    []byte
+		want []netlinkEvent
+	}{
+		{"connect", genlMessage(nl80211CmdConnect, netlinkAttr(nl80211AttrWiphy, netlinkUint32(0)),
+			netlinkAttr(nl80211AttrIfIndex, netlinkUint32(3)), netlinkAttr(nl80211AttrMac, mac)), []netlinkEvent{{index: 3}}},
+		{"disconnect", genlMessage(nl80211CmdDisconnect, netlinkAttr(nl80211AttrWiphy, netlinkUint32(1)),
+			netlinkAttr(nl80211AttrIfIndex, netlinkUint32(5))), []netlinkEvent{{index: 5}}},
+		{"without interface", genlMessage(nl80211CmdRegChange, netlinkAttr(nl80211AttrRegAlpha2, []byte("DE\x00"))), []netlinkEvent{}},
+		{"truncated header", netlinkMessage(nl80211FamilyId, []byte{nl80211CmdConnect}), []netlinkEvent{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := parseNetlinkEvents(tt.b, parseNl80211Event)
+			if err != nil {
+				t.Fatalf("parseNetlinkEvents() failed: %v", err)
+			}
+			if !slices.Equal(events, tt.want) {
+				t.Errorf("parseNetlinkEvents() = %v, want %v", events, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetlinkEventWlanDevice(t *testing.T) {
+	root := t.TempDir()
+	writeFakeFile(t, root, "sys/class/net/wlan0/wireless/uevent", "")
+	writeFakeFile(t, root, "sys/class/net/wlp2s0/phy80211/name", "phy0\n")
+	writeFakeFile(t, root, "sys/class/net/eth0/type", "1\n")
+	names := map[int]string{2: "eth0", 3: "wlan0", 4: "wlp2s0"}
+	nameByIndex := func(index int) string { return names[index] }
+
+	tests := []struct {
+		name  string
+		event netlinkEvent
+		want  string
+	}{
+		{"wireless by name", netlinkEvent{name: "wlan0"}, "wlan0"},
+		{"wireless by index", netlinkEvent{index: 3}, "wlan0"},
+		{"phy80211 by index", netlinkEvent{index: 4}, "wlp2s0"},
+		{"unrelated by name", netlinkEvent{name: "eth0"}, ""},
+		{"unrelated by index", netlinkEvent{index: 2}, ""},
+		{"unknown index", netlinkEvent{index: 9}, ""},
+		{"removed device", netlinkEvent{name: "wlan1"}, "wlan1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.wlanDevice(root, nameByIndex); got != tt.want {
+				t.Errorf("wlanDevice() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
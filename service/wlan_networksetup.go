@@ -0,0 +1,176 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/manuel-koch/go-auto-wlan/utils"
+)
+
+// NetworksetupWlanBackend controls WLAN devices on MacOS
+// using the "networksetup" and "ipconfig" commands.
+type NetworksetupWlanBackend struct {
+	runner CommandRunner
+}
+
+// wlanPortRe matches the names of WLAN hardware ports, e.g. "Wi-Fi" or "Wi-Fi 2".
+var wlanPortRe = regexp.MustCompile("^Wi-Fi")
+
+func NewNetworksetupWlanBackend(runner CommandRunner) *NetworksetupWlanBackend {
+	return &NetworksetupWlanBackend{runner: runner}
+}
+
+func (b *NetworksetupWlanBackend) GetWlanDevices() ([]WlanDevice, error) {
+	logger.Debug("Searching wlan devices...")
+
+	devices := make([]WlanDevice, 0)
+
+	if ports, err := listHardwarePorts(b.runner); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get network hardware ports: %v", err))
+		return devices, err
+	} else {
+		for _, port := range ports {
+			if wlanPortRe.MatchString(port.port) {
+				if state, err := b.GetWlanState(port.device); err == nil {
+					device := WlanDevice{Name: port.device, State: state}
+					if device.State == WlanPowerOn {
+						if network, err := b.GetWlanNetwork(port.device); err == nil {
+							device.Network = network
+						}
+					}
+					devices = append(devices, device)
+					logger.Debug(fmt.Sprintf("Found wlan device %s", device.String()))
+				}
+			}
+		}
+	}
+
+	return devices, nil
+}
+
+func (b *NetworksetupWlanBackend) GetWlanState(device string) (WlanState, error) {
+	if output, err := b.runner.Output("networksetup", "-getairportpower", device); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get network airport power: %v", err))
+		return WlanUnknown, err
+	} else {
+		stateRe := regexp.MustCompile(fmt.Sprintf("Wi-Fi\\s+Power\\s+\\(%s\\):\\s+(?P<state>\\S+)", device))
+		lines := strings.Split(string(output), "\n")
+		for _, line := range lines {
+			stateMatch := utils.MatchNamedExpression(stateRe, line)
+			if stateMatch != nil {
+				switch strings.ToLower(stateMatch["state"]) {
+				case "on":
+					{
+						return WlanPowerOn, nil
+					}
+				case "off":
+					{
+						return WlanPowerOff, nil
+					}
+				}
+			}
+		}
+		return WlanUnknown, nil
+	}
+}
+
+func (b *NetworksetupWlanBackend) SetWlanState(device string, state WlanState) error {
+	var power string
+	switch state {
+	case WlanPowerOn:
+		power = "on"
+	case WlanPowerOff:
+		power = "off"
+	default:
+		return InvalidWlanStateError{state: WlanUnknown}
+	}
+	if _, err := b.runner.Output("networksetup", "-setairportpower", device, power); err != nil {
+		logger.Error(fmt.Sprintf("Failed to set network airport power: %v", err))
+		return err
+	}
+	return nil
+}
+
+func (b *NetworksetupWlanBackend) GetWlanNetwork(device string) (string, error) {
+	// Newer versions of MacOS (Sequoia) don't seem to return useful information
+	// from the "networksetup -getairportnetwork <DEVICE>" call.
+	// Even when connected to Wifi, it just reports "You are not associated with an AirPort network.".
+	// Using alternative command "ipconfig getsummary <DEVICE>" if the former doesn't work.
+
+	if output, err := b.runner.Output("networksetup", "-getairportnetwork", device); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get network airport network: %v", err))
+	} else {
+		networkRe := regexp.MustCompile("Current\\s+Wi-Fi\\s+Network:\\s+(?P<network>.+)\\s*")
+		outputStr := string(output)
+		lines := strings.Split(outputStr, "\n")
+		for _, line := range lines {
+			networkMatch := utils.MatchNamedExpression(networkRe, line)
+			if networkMatch != nil {
+				return networkMatch["network"], nil
+			}
+		}
+	}
+
+	if output, err := b.runner.Output("ipconfig", "getsummary", device); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get ipconfig summary: %v", err))
+	} else {
+		networkRe := regexp.MustCompile("^\\s*SSID\\s+:\\s+(?P<ssid>.+)\\s*")
+		outputStr := string(output)
+		lines := strings.Split(outputStr, "\n")
+		for _, line := range lines {
+			networkMatch := utils.MatchNamedExpression(networkRe, line)
+			if networkMatch != nil {
+				return networkMatch["ssid"], nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// hardwarePort is one port reported by "networksetup -listallhardwareports".
+type hardwarePort struct {
+	port   string
+	device string
+}
+
+func listHardwarePorts(runner CommandRunner) ([]hardwarePort, error) {
+	outputBytes, err := runner.Output("networksetup", "-listallhardwareports")
+	if err != nil {
+		return nil, err
+	}
+
+	// merge non-empty lines into one line
+	outputStr := string(outputBytes)
+	mergeLinesRe := regexp.MustCompile("(\\S+)\\n")
+	outputStr = mergeLinesRe.ReplaceAllString(outputStr, "$1 ")
+
+	portRe := regexp.MustCompile("Hardware Port:\\s+(?P<port>.+?)\\s+Device:\\s+(?P<device>\\S+)")
+
+	ports := make([]hardwarePort, 0)
+	lines := strings.Split(outputStr, "\n")
+	for _, line := range lines {
+		portMatch := utils.MatchNamedExpression(portRe, line)
+		if portMatch != nil {
+			ports = append(ports, hardwarePort{port: portMatch["port"], device: portMatch["device"]})
+		}
+	}
+	return ports, nil
+}
@@ -0,0 +1,46 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"testing"
+)
+
+func TestNetworksetupWlanDevices(t *testing.T) {
+	runner := &fakeCommandRunner{outputs: map[string]string{
+		"networksetup -listallhardwareports":  readFixture(t, "networksetup-listallhardwareports.txt"),
+		"networksetup -getairportpower en1":   "Wi-Fi Power (en1): On\n",
+		"networksetup -getairportnetwork en1": "Current Wi-Fi Network: My Café Net\n",
+		"networksetup -getairportpower en7":   "Wi-Fi Power (en7): Off\n",
+	}}
+	devices, err := NewNetworksetupWlanBackend(runner).GetWlanDevices()
+	if err != nil {
+		t.Fatalf("GetWlanDevices() failed: %v", err)
+	}
+	want := []WlanDevice{
+		{Name: "en1", State: WlanPowerOn, Network: "My Café Net"},
+		{Name: "en7", State: WlanPowerOff},
+	}
+	if len(devices) != len(want) {
+		t.Fatalf("GetWlanDevices() = %v, want %v", devices, want)
+	}
+	for i := range want {
+		if devices[i] != want[i] {
+			t.Errorf("device %d = %s, want %s", i, devices[i].String(), want[i].String())
+		}
+	}
+}
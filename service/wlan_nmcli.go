@@ -0,0 +1,142 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NmcliWlanBackend controls WLAN devices on Linux
+// using the NetworkManager command line client "nmcli".
+// NetworkManager only provides a global WiFi radio switch,
+// so changing the power of one device affects all WLAN devices.
+type NmcliWlanBackend struct {
+	runner CommandRunner
+}
+
+func NewNmcliWlanBackend(runner CommandRunner) *NmcliWlanBackend {
+	return &NmcliWlanBackend{runner: runner}
+}
+
+func (b *NmcliWlanBackend) GetWlanDevices() ([]WlanDevice, error) {
+	logger.Debug("Searching wlan devices...")
+
+	devices := make([]WlanDevice, 0)
+
+	if output, err := b.runner.Output("nmcli", "-t", "-f", "DEVICE,TYPE,STATE,CONNECTION", "device"); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get network devices: %v", err))
+		return devices, err
+	} else {
+		lines := strings.Split(string(output), "\n")
+		for _, line := range lines {
+			fields := splitNmcliFields(line)
+			if len(fields) < 4 || fields[1] != "wifi" {
+				continue
+			}
+			deviceName := fields[0]
+			if state, err := b.GetWlanState(deviceName); err == nil {
+				device := WlanDevice{Name: deviceName, State: state}
+				if device.State == WlanPowerOn && fields[2] == "connected" {
+					if network, err := b.GetWlanNetwork(deviceName); err == nil {
+						device.Network = network
+					}
+				}
+				devices = append(devices, device)
+				logger.Debug(fmt.Sprintf("Found wlan device %s", device.String()))
+			}
+		}
+	}
+
+	return devices, nil
+}
+
+func (b *NmcliWlanBackend) GetWlanState(device string) (WlanState, error) {
+	if output, err := b.runner.Output("nmcli", "radio", "wifi"); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get wifi radio state: %v", err))
+		return WlanUnknown, err
+	} else {
+		switch strings.ToLower(strings.TrimSpace(string(output))) {
+		case "enabled":
+			return WlanPowerOn, nil
+		case "disabled":
+			return WlanPowerOff, nil
+		}
+		return WlanUnknown, nil
+	}
+}
+
+func (b *NmcliWlanBackend) SetWlanState(device string, state WlanState) error {
+	var power string
+	switch state {
+	case WlanPowerOn:
+		power = "on"
+	case WlanPowerOff:
+		power = "off"
+	default:
+		return InvalidWlanStateError{state: state}
+	}
+	if _, err := b.runner.Output("nmcli", "radio", "wifi", power); err != nil {
+		logger.Error(fmt.Sprintf("Failed to set wifi radio state: %v", err))
+		return err
+	}
+	return nil
+}
+
+func (b *NmcliWlanBackend) GetWlanNetwork(device string) (string, error) {
+	if output, err := b.runner.Output("nmcli", "-t", "-f", "ACTIVE,SSID", "device", "wifi", "list", "ifname", device, "--rescan", "no"); err != nil {
+		logger.Error(fmt.Sprintf("Failed to get wifi networks: %v", err))
+		return "", err
+	} else {
+		lines := strings.Split(string(output), "\n")
+		for _, line := range lines {
+			fields := splitNmcliFields(line)
+			if len(fields) >= 2 && fields[0] == "yes" {
+				return fields[1], nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// splitNmcliFields splits one line of nmcli terse output into its fields.
+// Terse output separates fields by ":" and escapes literal ":" and "\" in values
+// with a backslash.
+func splitNmcliFields(line string) []string {
+	line = strings.TrimRight(line, "\r")
+	if len(line) == 0 {
+		return nil
+	}
+	fields := make([]string, 0)
+	var field strings.Builder
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ':':
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteRune(r)
+		}
+	}
+	return append(fields, field.String())
+}
@@ -0,0 +1,121 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// fakeNmcli answers the nmcli commands used by the backend,
+// keeping the radio state in a file next to the script.
+const fakeNmcli = `#!/bin/sh
+radio="$(dirname "$0")/radio"
+case "$*" in
+"-t -f DEVICE,TYPE,STATE,CONNECTION device")
+	if [ "$(cat "$radio")" = "enabled" ]; then
+		printf 'wlp2s0:wifi:connected:My\\:Net\n'
+	else
+		printf 'wlp2s0:wifi:unavailable:\n'
+	fi
+	printf 'enp0s31f6:ethernet:unavailable:\nlo:loopback:unmanaged:\n'
+	;;
+"radio wifi")
+	cat "$radio"
+	;;
+"radio wifi on")
+	echo enabled > "$radio"
+	;;
+"radio wifi off")
+	echo disabled > "$radio"
+	;;
+"-t -f ACTIVE,SSID device wifi list ifname wlp2s0 --rescan no")
+	printf 'no:Other\nyes:My\\:Net\n'
+	;;
+*)
+	echo "unexpected arguments: $*" >&2
+	exit 2
+	;;
+esac
+`
+
+// installFakeNmcli puts the fake nmcli script first on PATH.
+func installFakeNmcli(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake nmcli needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "nmcli"), []byte(fakeNmcli), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "radio"), []byte("enabled\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSplitNmcliFields(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{line: "", want: nil},
+		{line: "wlp2s0:wifi:connected:Home", want: []string{"wlp2s0", "wifi", "connected", "Home"}},
+		{line: "wlp2s0:wifi:connected:My\\:Net", want: []string{"wlp2s0", "wifi", "connected", "My:Net"}},
+		{line: "yes:back\\\\slash\r", want: []string{"yes", "back\\slash"}},
+		{line: "lo:loopback:unmanaged:", want: []string{"lo", "loopback", "unmanaged", ""}},
+	}
+	for _, tt := range tests {
+		if got := splitNmcliFields(tt.line); !slices.Equal(got, tt.want) {
+			t.Errorf("splitNmcliFields(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestNmcliWlanBackend(t *testing.T) {
+	installFakeNmcli(t)
+	backend := NewNmcliWlanBackend(ExecCommandRunner{})
+
+	devices, err := backend.GetWlanDevices()
+	if err != nil {
+		t.Fatalf("GetWlanDevices() error = %v", err)
+	}
+	want := []WlanDevice{{Name: "wlp2s0", State: WlanPowerOn, Network: "My:Net"}}
+	if !slices.Equal(devices, want) {
+		t.Fatalf("GetWlanDevices() = %v, want %v", devices, want)
+	}
+
+	if err := backend.SetWlanState("wlp2s0", WlanPowerOff); err != nil {
+		t.Fatalf("SetWlanState() error = %v", err)
+	}
+	devices, err = backend.GetWlanDevices()
+	if err != nil {
+		t.Fatalf("GetWlanDevices() error = %v", err)
+	}
+	want = []WlanDevice{{Name: "wlp2s0", State: WlanPowerOff}}
+	if !slices.Equal(devices, want) {
+		t.Fatalf("GetWlanDevices() after switching off = %v, want %v", devices, want)
+	}
+
+	if err := backend.SetWlanState("wlp2s0", WlanHardBlocked); err == nil {
+		t.Errorf("SetWlanState() with hard blocked state should fail")
+	}
+}
@@ -0,0 +1,208 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RfkillWlanBackend controls WLAN radios on Linux
+// using the rfkill switches in "/sys/class/rfkill".
+type RfkillWlanBackend struct {
+	root string
+}
+
+// rfkillSwitch is one rfkill switch found in sysfs.
+type rfkillSwitch struct {
+	path   string
+	device string
+}
+
+// NewRfkillWlanBackend returns a WLAN backend using sysfs below given root path,
+// which is "/" for the real system.
+func NewRfkillWlanBackend(root string) *RfkillWlanBackend {
+	return &RfkillWlanBackend{root: root}
+}
+
+func (b *RfkillWlanBackend) GetWlanDevices() ([]WlanDevice, error) {
+	logger.Debug("Searching wlan devices...")
+
+	devices := make([]WlanDevice, 0)
+
+	switches, err := b.findSwitches()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get rfkill switches: %v", err))
+		return devices, err
+	}
+	for _, sw := range switches {
+		if state, err := sw.wlanState(); err == nil {
+			device := WlanDevice{Name: sw.device, State: state}
+			devices = append(devices, device)
+			logger.Debug(fmt.Sprintf("Found wlan device %s", device.String()))
+		}
+	}
+
+	return devices, nil
+}
+
+func (b *RfkillWlanBackend) GetWlanState(device string) (WlanState, error) {
+	sw, err := b.findSwitch(device)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get rfkill state: %v", err))
+		return WlanUnknown, err
+	}
+	return sw.wlanState()
+}
+
+func (b *RfkillWlanBackend) SetWlanState(device string, state WlanState) error {
+	var soft bool
+	switch state {
+	case WlanPowerOn:
+		soft = false
+	case WlanPowerOff:
+		soft = true
+	default:
+		return InvalidWlanStateError{state: state}
+	}
+	sw, err := b.findSwitch(device)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to set rfkill state: %v", err))
+		return err
+	}
+	if hard, err := sw.readFlag("hard"); err != nil {
+		logger.Error(fmt.Sprintf("Failed to set rfkill state: %v", err))
+		return err
+	} else if hard {
+		err := WlanHardBlockedError{device: device}
+		logger.Error(fmt.Sprintf("Failed to set rfkill state: %v", err))
+		return err
+	}
+	if err := sw.setSoftBlock(soft); err != nil {
+		logger.Error(fmt.Sprintf("Failed to set rfkill state: %v", err))
+		return err
+	}
+	return nil
+}
+
+// GetWlanNetwork always reports no network,
+// rfkill only knows about the radio itself.
+func (b *RfkillWlanBackend) GetWlanNetwork(device string) (string, error) {
+	return "", nil
+}
+
+// findSwitches returns all rfkill switches of type "wlan".
+func (b *RfkillWlanBackend) findSwitches() ([]rfkillSwitch, error) {
+	return findRfkillSwitches(b.root, "wlan")
+}
+
+func (b *RfkillWlanBackend) findSwitch(device string) (rfkillSwitch, error) {
+	switches, err := b.findSwitches()
+	if err != nil {
+		return rfkillSwitch{}, err
+	}
+	for _, sw := range switches {
+		if sw.device == device {
+			return sw, nil
+		}
+	}
+	return rfkillSwitch{}, fmt.Errorf("no rfkill switch for device %s", device)
+}
+
+// wlanState maps the block state of the switch to the state of a WLAN radio.
+func (s rfkillSwitch) wlanState() (WlanState, error) {
+	soft, hard, err := s.blocked()
+	switch {
+	case err != nil:
+		return WlanUnknown, err
+	case hard:
+		return WlanHardBlocked, nil
+	case soft:
+		return WlanPowerOff, nil
+	default:
+		return WlanPowerOn, nil
+	}
+}
+
+// blocked returns whether the radio is blocked by software and by hardware switch.
+func (s rfkillSwitch) blocked() (bool, bool, error) {
+	hard, err := s.readFlag("hard")
+	if err != nil {
+		return false, false, err
+	}
+	soft, err := s.readFlag("soft")
+	if err != nil {
+		return false, hard, err
+	}
+	return soft, hard, nil
+}
+
+// findRfkillSwitches returns all rfkill switches of given type below given sysfs root.
+func findRfkillSwitches(root string, kind string) ([]rfkillSwitch, error) {
+	paths, err := filepath.Glob(filepath.Join(root, "sys", "class", "rfkill", "rfkill*"))
+	if err != nil {
+		return nil, err
+	}
+	switches := make([]rfkillSwitch, 0)
+	for _, path := range paths {
+		if switchKind, err := readSysfsValue(filepath.Join(path, "type")); err != nil || switchKind != kind {
+			continue
+		}
+		switches = append(switches, rfkillSwitch{path: path, device: rfkillDeviceName(path)})
+	}
+	return switches, nil
+}
+
+func (s rfkillSwitch) setSoftBlock(blocked bool) error {
+	value := "0"
+	if blocked {
+		value = "1"
+	}
+	return os.WriteFile(filepath.Join(s.path, "soft"), []byte(value), 0644)
+}
+
+func (s rfkillSwitch) readFlag(name string) (bool, error) {
+	value, err := readSysfsValue(filepath.Join(s.path, name))
+	if err != nil {
+		return false, err
+	}
+	return value == "1", nil
+}
+
+// rfkillDeviceName returns the network interface name of the rfkill switch at given path,
+// falling back to the name of the switch itself, e.g. "phy0".
+func rfkillDeviceName(path string) string {
+	for _, netDir := range []string{"device/net", "device/device/net"} {
+		if entries, err := os.ReadDir(filepath.Join(path, netDir)); err == nil && len(entries) > 0 {
+			return entries[0].Name()
+		}
+	}
+	if name, err := readSysfsValue(filepath.Join(path, "name")); err == nil && len(name) > 0 {
+		return name
+	}
+	return filepath.Base(path)
+}
+
+func readSysfsValue(path string) (string, error) {
+	value, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(value)), nil
+}
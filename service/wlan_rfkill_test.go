@@ -0,0 +1,154 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeRfkillSwitch is one rfkill switch of a fake sysfs tree.
+type fakeRfkillSwitch struct {
+	name   string
+	kind   string
+	netDev string
+	soft   string
+	hard   string
+}
+
+// writeFakeRfkill creates given rfkill switches below a temp root and returns the root.
+func writeFakeRfkill(t *testing.T, switches []fakeRfkillSwitch) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, sw := range switches {
+		dir := filepath.Join("sys/class/rfkill", sw.name)
+		writeFakeFile(t, root, filepath.Join(dir, "type"), sw.kind+"\n")
+		writeFakeFile(t, root, filepath.Join(dir, "name"), "phy0\n")
+		writeFakeFile(t, root, filepath.Join(dir, "soft"), sw.soft+"\n")
+		writeFakeFile(t, root, filepath.Join(dir, "hard"), sw.hard+"\n")
+		if len(sw.netDev) > 0 {
+			if err := os.MkdirAll(filepath.Join(root, dir, "device/net", sw.netDev), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+func TestRfkillWlanBackendGetWlanDevices(t *testing.T) {
+	tests := []struct {
+		name     string
+		switches []fakeRfkillSwitch
+		want     []WlanDevice
+	}{
+		{
+			name: "unblocked",
+			switches: []fakeRfkillSwitch{
+				{name: "rfkill0", kind: "wlan", netDev: "wlan0", soft: "0", hard: "0"},
+			},
+			want: []WlanDevice{{Name: "wlan0", State: WlanPowerOn}},
+		},
+		{
+			name: "soft blocked",
+			switches: []fakeRfkillSwitch{
+				{name: "rfkill0", kind: "wlan", netDev: "wlan0", soft: "1", hard: "0"},
+			},
+			want: []WlanDevice{{Name: "wlan0", State: WlanPowerOff}},
+		},
+		{
+			name: "hard blocked",
+			switches: []fakeRfkillSwitch{
+				{name: "rfkill0", kind: "wlan", netDev: "wlan0", soft: "1", hard: "1"},
+			},
+			want: []WlanDevice{{Name: "wlan0", State: WlanHardBlocked}},
+		},
+		{
+			name: "without network interface",
+			switches: []fakeRfkillSwitch{
+				{name: "rfkill0", kind: "wlan", soft: "0", hard: "0"},
+			},
+			want: []WlanDevice{{Name: "phy0", State: WlanPowerOn}},
+		},
+		{
+			name: "other types ignored",
+			switches: []fakeRfkillSwitch{
+				{name: "rfkill0", kind: "bluetooth", soft: "0", hard: "0"},
+				{name: "rfkill1", kind: "wlan", netDev: "wlan0", soft: "0", hard: "0"},
+			},
+			want: []WlanDevice{{Name: "wlan0", State: WlanPowerOn}},
+		},
+		{
+			name: "none",
+			want: []WlanDevice{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := NewRfkillWlanBackend(writeFakeRfkill(t, tt.switches))
+			got, err := backend.GetWlanDevices()
+			if err != nil {
+				t.Fatalf("GetWlanDevices() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("GetWlanDevices() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("GetWlanDevices()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRfkillWlanBackendSetWlanState(t *testing.T) {
+	tests := []struct {
+		name     string
+		hard     string
+		state    WlanState
+		wantSoft string
+		wantErr  bool
+	}{
+		{name: "switch off", hard: "0", state: WlanPowerOff, wantSoft: "1"},
+		{name: "switch on", hard: "0", state: WlanPowerOn, wantSoft: "0"},
+		{name: "hard blocked", hard: "1", state: WlanPowerOn, wantSoft: "1", wantErr: true},
+		{name: "invalid state", hard: "0", state: WlanHardBlocked, wantSoft: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeFakeRfkill(t, []fakeRfkillSwitch{
+				{name: "rfkill0", kind: "wlan", netDev: "wlan0", soft: "1", hard: tt.hard},
+			})
+			err := NewRfkillWlanBackend(root).SetWlanState("wlan0", tt.state)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetWlanState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.hard == "1" && !errors.As(err, &WlanHardBlockedError{}) {
+				t.Errorf("SetWlanState() error = %v, want WlanHardBlockedError", err)
+			}
+			soft, err := readSysfsValue(filepath.Join(root, "sys/class/rfkill/rfkill0/soft"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if soft != tt.wantSoft {
+				t.Errorf("soft = %s, want %s", soft, tt.wantSoft)
+			}
+		})
+	}
+}
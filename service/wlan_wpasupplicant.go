@@ -0,0 +1,202 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// WpaSupplicantCtrlDir is the default directory of the wpa_supplicant control sockets.
+	WpaSupplicantCtrlDir = "/var/run/wpa_supplicant"
+
+	wpaSupplicantTimeout = 2 * time.Second
+)
+
+// wpaSupplicantRequests numbers the local sockets of concurrent requests.
+var wpaSupplicantRequests atomic.Uint64
+
+// WpaSupplicantWlanBackend controls WLAN devices on Linux
+// by talking to the wpa_supplicant control interface directly.
+// Powering a device off disconnects it, powering it on reconnects it.
+type WpaSupplicantWlanBackend struct {
+	ctrlDir string
+}
+
+// NewWpaSupplicantWlanBackend returns a WLAN backend using the control sockets
+// in given directory, one socket per interface.
+func NewWpaSupplicantWlanBackend(ctrlDir string) *WpaSupplicantWlanBackend {
+	return &WpaSupplicantWlanBackend{ctrlDir: ctrlDir}
+}
+
+func (b *WpaSupplicantWlanBackend) GetWlanDevices() ([]WlanDevice, error) {
+	logger.Debug("Searching wlan devices...")
+
+	devices := make([]WlanDevice, 0)
+
+	entries, err := os.ReadDir(b.ctrlDir)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get wpa_supplicant interfaces: %v", err))
+		return devices, err
+	}
+	for _, entry := range entries {
+		if entry.Type()&os.ModeSocket == 0 {
+			continue
+		}
+		deviceName := entry.Name()
+		status, err := b.status(deviceName)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to get wpa_supplicant status: %v", err))
+			continue
+		}
+		device := WlanDevice{Name: deviceName, State: wpaStateToWlanState(status["wpa_state"])}
+		if status["wpa_state"] == "COMPLETED" {
+			device.Network = status["ssid"]
+			if signal, err := b.signal(deviceName); err == nil {
+				device.Signal = signal
+			}
+		}
+		devices = append(devices, device)
+		logger.Debug(fmt.Sprintf("Found wlan device %s", device.String()))
+	}
+
+	return devices, nil
+}
+
+func (b *WpaSupplicantWlanBackend) GetWlanState(device string) (WlanState, error) {
+	status, err := b.status(device)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get wpa_supplicant status: %v", err))
+		return WlanUnknown, err
+	}
+	return wpaStateToWlanState(status["wpa_state"]), nil
+}
+
+func (b *WpaSupplicantWlanBackend) SetWlanState(device string, state WlanState) error {
+	var command string
+	switch state {
+	case WlanPowerOn:
+		command = "RECONNECT"
+	case WlanPowerOff:
+		command = "DISCONNECT"
+	default:
+		return InvalidWlanStateError{state: state}
+	}
+	reply, err := b.request(device, command)
+	if err == nil && strings.TrimSpace(reply) != "OK" {
+		err = fmt.Errorf("%s failed: %s", command, strings.TrimSpace(reply))
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to set wpa_supplicant state: %v", err))
+		return err
+	}
+	return nil
+}
+
+func (b *WpaSupplicantWlanBackend) GetWlanNetwork(device string) (string, error) {
+	status, err := b.status(device)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get wpa_supplicant status: %v", err))
+		return "", err
+	}
+	if status["wpa_state"] == "COMPLETED" {
+		return status["ssid"], nil
+	}
+	return "", nil
+}
+
+func (b *WpaSupplicantWlanBackend) status(device string) (map[string]string, error) {
+	reply, err := b.request(device, "STATUS")
+	if err != nil {
+		return nil, err
+	}
+	return parseWpaKeyValues(reply), nil
+}
+
+// signal returns the RSSI of the current connection in dBm.
+func (b *WpaSupplicantWlanBackend) signal(device string) (int, error) {
+	reply, err := b.request(device, "SIGNAL_POLL")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(parseWpaKeyValues(reply)["RSSI"])
+}
+
+// request sends a command to the control socket of named device and returns the reply.
+// The control interface uses datagrams, replies are sent to the address of the
+// requesting socket, so we need to bind a local socket too.
+func (b *WpaSupplicantWlanBackend) request(device string, command string) (string, error) {
+	localPath := filepath.Join(os.TempDir(),
+		fmt.Sprintf("autowlan-wpa-%d-%d", os.Getpid(), wpaSupplicantRequests.Add(1)))
+	// binding creates the local socket file even when connecting fails
+	defer os.Remove(localPath)
+	local := &net.UnixAddr{Name: localPath, Net: "unixgram"}
+	remote := &net.UnixAddr{Name: filepath.Join(b.ctrlDir, device), Net: "unixgram"}
+
+	conn, err := net.DialUnix("unixgram", local, remote)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(wpaSupplicantTimeout)); err != nil {
+		return "", err
+	}
+	if _, err := conn.Write([]byte(command)); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		reply := string(buf[:n])
+		// skip unsolicited event messages like "<3>CTRL-EVENT-..."
+		if !strings.HasPrefix(reply, "<") {
+			return reply, nil
+		}
+	}
+}
+
+func parseWpaKeyValues(reply string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(reply, "\n") {
+		if key, value, found := strings.Cut(line, "="); found {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+func wpaStateToWlanState(wpaState string) WlanState {
+	switch wpaState {
+	case "":
+		return WlanUnknown
+	case "DISCONNECTED", "INTERFACE_DISABLED":
+		return WlanPowerOff
+	default:
+		return WlanPowerOn
+	}
+}
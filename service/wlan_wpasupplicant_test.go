@@ -0,0 +1,137 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package service
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// startFakeWpaSupplicant serves the wpa_supplicant control interface of one device
+// from a unix datagram socket in given directory, until the test is done.
+func startFakeWpaSupplicant(t *testing.T, ctrlDir string, device string) {
+	t.Helper()
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(ctrlDir, device), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		wpaState := "COMPLETED"
+		buf := make([]byte, 4096)
+		for {
+			n, addr, err := conn.ReadFromUnix(buf)
+			if err != nil {
+				return
+			}
+			var reply string
+			switch string(buf[:n]) {
+			case "STATUS":
+				reply = "bssid=aa:bb:cc:dd:ee:ff\nssid=My Net\nwpa_state=" + wpaState + "\n"
+				if wpaState != "COMPLETED" {
+					reply = "wpa_state=" + wpaState + "\n"
+				}
+			case "SIGNAL_POLL":
+				reply = "RSSI=-61\nLINKSPEED=866\nNOISE=9999\nFREQUENCY=5180\n"
+			case "DISCONNECT":
+				wpaState = "DISCONNECTED"
+				reply = "OK\n"
+			case "RECONNECT":
+				wpaState = "COMPLETED"
+				reply = "OK\n"
+			default:
+				reply = "UNKNOWN COMMAND\n"
+			}
+			// unsolicited events may arrive before the reply
+			conn.WriteToUnix([]byte("<3>CTRL-EVENT-SCAN-STARTED "), addr)
+			conn.WriteToUnix([]byte(reply), addr)
+		}
+	}()
+}
+
+// localWpaSockets returns the local sockets of requests left in the temp directory.
+func localWpaSockets(t *testing.T) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(os.TempDir(), "autowlan-wpa-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestWpaSupplicantWlanBackend(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	ctrlDir := t.TempDir()
+	startFakeWpaSupplicant(t, ctrlDir, "wlan0")
+	backend := NewWpaSupplicantWlanBackend(ctrlDir)
+
+	devices, err := backend.GetWlanDevices()
+	if err != nil {
+		t.Fatalf("GetWlanDevices() error = %v", err)
+	}
+	want := []WlanDevice{{Name: "wlan0", State: WlanPowerOn, Network: "My Net", Signal: -61}}
+	if !slices.Equal(devices, want) {
+		t.Fatalf("GetWlanDevices() = %v, want %v", devices, want)
+	}
+
+	if err := backend.SetWlanState("wlan0", WlanPowerOff); err != nil {
+		t.Fatalf("SetWlanState() error = %v", err)
+	}
+	if state, err := backend.GetWlanState("wlan0"); err != nil || state != WlanPowerOff {
+		t.Errorf("GetWlanState() after disconnect = %s, %v, want off", WlanStateToString(state), err)
+	}
+	if network, err := backend.GetWlanNetwork("wlan0"); err != nil || len(network) > 0 {
+		t.Errorf("GetWlanNetwork() after disconnect = %q, %v, want none", network, err)
+	}
+
+	if err := backend.SetWlanState("wlan0", WlanPowerOn); err != nil {
+		t.Fatalf("SetWlanState() error = %v", err)
+	}
+	if network, err := backend.GetWlanNetwork("wlan0"); err != nil || network != "My Net" {
+		t.Errorf("GetWlanNetwork() after reconnect = %q, %v, want My Net", network, err)
+	}
+
+	if leftovers := localWpaSockets(t); len(leftovers) > 0 {
+		t.Errorf("local sockets left behind: %s", strings.Join(leftovers, ", "))
+	}
+}
+
+func TestWpaSupplicantWlanBackendStaleSocket(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	ctrlDir := t.TempDir()
+	// a socket file without wpa_supplicant listening, e.g. after it crashed
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(ctrlDir, "wlan0"), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	backend := NewWpaSupplicantWlanBackend(ctrlDir)
+
+	for i := 0; i < 3; i++ {
+		if _, err := backend.GetWlanState("wlan0"); err == nil {
+			t.Fatalf("GetWlanState() of stale socket should fail")
+		}
+	}
+	if leftovers := localWpaSockets(t); len(leftovers) > 0 {
+		t.Errorf("local sockets left behind: %s", strings.Join(leftovers, ", "))
+	}
+}
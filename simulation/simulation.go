@@ -0,0 +1,402 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package simulation
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/service"
+	"github.com/manuel-koch/go-auto-wlan/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario is a timeline of lid and WLAN states to simulate.
+type Scenario struct {
+	Steps []Step `yaml:"steps"`
+}
+
+// Step changes the simulated state at given offset from the start of the simulation.
+type Step struct {
+	At        time.Duration  `yaml:"at"`
+	Lid       string         `yaml:"lid"`
+	Bluetooth string         `yaml:"bluetooth"`
+	Power     string         `yaml:"power"`
+	Devices   []DeviceStep   `yaml:"devices"`
+	Ethernet  []EthernetStep `yaml:"ethernet"`
+
+	// optional values, only changed when set
+	ExternalDisplay *bool `yaml:"external_display"`
+	Battery         *int  `yaml:"battery"`
+}
+
+// DeviceStep changes the simulated state of one WLAN device.
+type DeviceStep struct {
+	Name    string `yaml:"name"`
+	Power   string `yaml:"power"`
+	Network string `yaml:"network"`
+	// Removed unplugs the device, a later step with the device plugs it in again.
+	Removed bool `yaml:"removed"`
+}
+
+// EthernetStep changes the simulated link state of one wired device.
+type EthernetStep struct {
+	Name string `yaml:"name"`
+	Link string `yaml:"link"`
+}
+
+// LoadScenario loads a scenario from YAML file at given path, e.g.
+//
+//	steps:
+//	  - at: 0s
+//	    lid: open
+//	    devices:
+//	      - name: en0
+//	        power: "on"
+//	        network: Office
+//	  - at: 10s
+//	    lid: closed
+//	  - at: 20s
+//	    lid: open
+func LoadScenario(path string) (*Scenario, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scenario Scenario
+	if err := yaml.Unmarshal(content, &scenario); err != nil {
+		return nil, err
+	}
+	for i, step := range scenario.Steps {
+		if _, err := parseLidState(step.Lid); err != nil {
+			return nil, fmt.Errorf("step %d: %v", i+1, err)
+		}
+		if _, err := parseBluetoothState(step.Bluetooth); err != nil {
+			return nil, fmt.Errorf("step %d: %v", i+1, err)
+		}
+		if _, err := parsePowerSource(step.Power); err != nil {
+			return nil, fmt.Errorf("step %d: %v", i+1, err)
+		}
+		for _, device := range step.Devices {
+			if len(device.Name) == 0 {
+				return nil, fmt.Errorf("step %d: device without name", i+1)
+			}
+			if _, err := parseWlanState(device.Power); err != nil {
+				return nil, fmt.Errorf("step %d: %v", i+1, err)
+			}
+		}
+		for _, device := range step.Ethernet {
+			if len(device.Name) == 0 {
+				return nil, fmt.Errorf("step %d: ethernet device without name", i+1)
+			}
+			if _, err := parseEthernetLinkState(device.Link); err != nil {
+				return nil, fmt.Errorf("step %d: %v", i+1, err)
+			}
+		}
+	}
+	slices.SortStableFunc(scenario.Steps, func(a, b Step) int {
+		return cmp.Compare(a.At, b.At)
+	})
+	return &scenario, nil
+}
+
+// Simulator replays a scenario as lid sensor, WLAN, Bluetooth, Ethernet and power source backend,
+// advancing the timeline whenever the service probes it.
+type Simulator struct {
+	mutex    sync.Mutex
+	scenario *Scenario
+	clock    utils.Clock
+	start    time.Time
+	applied  int
+
+	lidState        service.LidState
+	externalDisplay bool
+	bluetoothState  service.BluetoothState
+	devices         []service.WlanDevice
+	networks        map[string]string
+	ethernet        []service.EthernetDevice
+	powerState      service.PowerState
+}
+
+// NewSimulator returns the simulator of given scenario,
+// its timeline starts now and advances with given clock.
+func NewSimulator(scenario *Scenario, clock utils.Clock) *Simulator {
+	return &Simulator{
+		scenario:   scenario,
+		clock:      clock,
+		start:      clock.Now(),
+		devices:    make([]service.WlanDevice, 0),
+		networks:   map[string]string{},
+		ethernet:   make([]service.EthernetDevice, 0),
+		powerState: service.PowerState{Source: service.PowerSourceUnknown, Percentage: -1},
+	}
+}
+
+// Backends returns the service backends driven by the simulation.
+func (s *Simulator) Backends() service.Backends {
+	return service.Backends{
+		Wlan:      s,
+		Lid:       s,
+		Bluetooth: s,
+		Ethernet:  s,
+		Power:     s,
+	}
+}
+
+// advance applies all steps that are due, caller must hold the mutex.
+func (s *Simulator) advance() {
+	elapsed := s.clock.Now().Sub(s.start)
+	for s.applied < len(s.scenario.Steps) && s.scenario.Steps[s.applied].At <= elapsed {
+		step := s.scenario.Steps[s.applied]
+		s.applied++
+		logger.Info(fmt.Sprintf("Simulation step %d at %s", s.applied, step.At))
+		if lidState, _ := parseLidState(step.Lid); lidState != service.LidUnknown {
+			logger.Info(fmt.Sprintf("Simulating lid %s", service.LidStateToString(lidState)))
+			s.lidState = lidState
+		}
+		if step.ExternalDisplay != nil {
+			logger.Info(fmt.Sprintf("Simulating external display %t", *step.ExternalDisplay))
+			s.externalDisplay = *step.ExternalDisplay
+		}
+		if bluetoothState, _ := parseBluetoothState(step.Bluetooth); bluetoothState != service.BluetoothUnknown {
+			logger.Info(fmt.Sprintf("Simulating bluetooth %s", service.BluetoothStateToString(bluetoothState)))
+			s.bluetoothState = bluetoothState
+		}
+		if powerSource, _ := parsePowerSource(step.Power); powerSource != service.PowerSourceUnknown {
+			s.powerState.Source = powerSource
+		}
+		if step.Battery != nil {
+			s.powerState.Percentage = *step.Battery
+		}
+		if len(step.Power) > 0 || step.Battery != nil {
+			logger.Info(fmt.Sprintf("Simulating power %s", s.powerState.String()))
+		}
+		for _, deviceStep := range step.Devices {
+			s.applyDeviceStep(deviceStep)
+		}
+		for _, ethernetStep := range step.Ethernet {
+			s.applyEthernetStep(ethernetStep)
+		}
+	}
+}
+
+func (s *Simulator) applyDeviceStep(step DeviceStep) {
+	i := slices.IndexFunc(s.devices, func(d service.WlanDevice) bool { return d.Name == step.Name })
+	if step.Removed {
+		if i >= 0 {
+			s.devices = slices.Delete(s.devices, i, i+1)
+		}
+		logger.Info(fmt.Sprintf("Simulating removed wlan device %s", step.Name))
+		return
+	}
+	if i < 0 {
+		s.devices = append(s.devices, service.WlanDevice{Name: step.Name, State: service.WlanPowerOff})
+		i = len(s.devices) - 1
+	}
+	device := &s.devices[i]
+	if len(step.Network) > 0 {
+		s.networks[step.Name] = step.Network
+	}
+	if state, _ := parseWlanState(step.Power); state != service.WlanUnknown {
+		device.State = state
+	}
+	if device.State == service.WlanPowerOn {
+		device.Network = s.networks[step.Name]
+	} else {
+		device.Network = ""
+	}
+	logger.Info(fmt.Sprintf("Simulating wlan device %s", device.String()))
+}
+
+func (s *Simulator) applyEthernetStep(step EthernetStep) {
+	i := slices.IndexFunc(s.ethernet, func(d service.EthernetDevice) bool { return d.Name == step.Name })
+	if i < 0 {
+		s.ethernet = append(s.ethernet, service.EthernetDevice{Name: step.Name, Port: "Ethernet"})
+		i = len(s.ethernet) - 1
+	}
+	device := &s.ethernet[i]
+	device.Link, _ = parseEthernetLinkState(step.Link)
+	logger.Info(fmt.Sprintf("Simulating ethernet device %s", device.String()))
+}
+
+func (s *Simulator) GetLidState() (service.LidState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.advance()
+	return s.lidState, nil
+}
+
+func (s *Simulator) HasExternalDisplay() (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.advance()
+	return s.externalDisplay, nil
+}
+
+func (s *Simulator) GetWlanDevices() ([]service.WlanDevice, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.advance()
+	return service.CopyWlanDevices(s.devices), nil
+}
+
+func (s *Simulator) GetWlanState(device string) (service.WlanState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.advance()
+	for _, d := range s.devices {
+		if d.Name == device {
+			return d.State, nil
+		}
+	}
+	return service.WlanUnknown, fmt.Errorf("unknown simulated device %s", device)
+}
+
+func (s *Simulator) SetWlanState(device string, state service.WlanState) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.advance()
+	if state != service.WlanPowerOn && state != service.WlanPowerOff {
+		return service.InvalidWlanStateError{}
+	}
+	for i := range s.devices {
+		if s.devices[i].Name == device {
+			logger.Info(fmt.Sprintf("Simulation action: switching wlan device %s %s", device, service.WlanStateToString(state)))
+			s.applyDeviceStep(DeviceStep{Name: device, Power: service.WlanStateToString(state)})
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown simulated device %s", device)
+}
+
+func (s *Simulator) GetWlanNetwork(device string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.advance()
+	for _, d := range s.devices {
+		if d.Name == device {
+			return d.Network, nil
+		}
+	}
+	return "", fmt.Errorf("unknown simulated device %s", device)
+}
+
+func (s *Simulator) GetBluetoothState() (service.BluetoothState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.advance()
+	return s.bluetoothState, nil
+}
+
+func (s *Simulator) SetBluetoothState(state service.BluetoothState) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.advance()
+	if state != service.BluetoothPowerOn && state != service.BluetoothPowerOff {
+		return service.InvalidBluetoothStateError{}
+	}
+	if s.bluetoothState == service.BluetoothUnknown {
+		return fmt.Errorf("no simulated bluetooth")
+	}
+	logger.Info(fmt.Sprintf("Simulation action: switching bluetooth %s", service.BluetoothStateToString(state)))
+	s.bluetoothState = state
+	return nil
+}
+
+func (s *Simulator) GetEthernetDevices() ([]service.EthernetDevice, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.advance()
+	return service.CopyEthernetDevices(s.ethernet), nil
+}
+
+func (s *Simulator) GetPowerState() (service.PowerState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.advance()
+	return s.powerState, nil
+}
+
+func parseLidState(value string) (service.LidState, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return service.LidUnknown, nil
+	case "open":
+		return service.LidOpen, nil
+	case "closed":
+		return service.LidClosed, nil
+	default:
+		return service.LidUnknown, fmt.Errorf("invalid lid state '%s', use 'open' or 'closed'", value)
+	}
+}
+
+func parseWlanState(value string) (service.WlanState, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return service.WlanUnknown, nil
+	case "on":
+		return service.WlanPowerOn, nil
+	case "off":
+		return service.WlanPowerOff, nil
+	default:
+		return service.WlanUnknown, fmt.Errorf("invalid power state '%s', use 'on' or 'off'", value)
+	}
+}
+
+func parseBluetoothState(value string) (service.BluetoothState, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return service.BluetoothUnknown, nil
+	case "on":
+		return service.BluetoothPowerOn, nil
+	case "off":
+		return service.BluetoothPowerOff, nil
+	default:
+		return service.BluetoothUnknown, fmt.Errorf("invalid bluetooth state '%s', use 'on' or 'off'", value)
+	}
+}
+
+func parseEthernetLinkState(value string) (service.EthernetLinkState, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return service.EthernetUnknown, nil
+	case "up":
+		return service.EthernetLinkUp, nil
+	case "down":
+		return service.EthernetLinkDown, nil
+	default:
+		return service.EthernetUnknown, fmt.Errorf("invalid link state '%s', use 'up' or 'down'", value)
+	}
+}
+
+func parsePowerSource(value string) (service.PowerSource, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return service.PowerSourceUnknown, nil
+	case "ac":
+		return service.PowerSourceAC, nil
+	case "battery":
+		return service.PowerSourceBattery, nil
+	default:
+		return service.PowerSourceUnknown, fmt.Errorf("invalid power source '%s', use 'ac' or 'battery'", value)
+	}
+}
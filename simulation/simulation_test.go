@@ -0,0 +1,163 @@
+// This file is part of go-auto-wlan.
+//
+// go-auto-wlan is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-auto-wlan is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-auto-wlan. If not, see <http://www.gnu.org/licenses/>.
+//
+// Copyright 2023 Manuel Koch
+package simulation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/manuel-koch/go-auto-wlan/service"
+	"github.com/manuel-koch/go-auto-wlan/utils/clocktest"
+)
+
+// writeScenario writes given YAML content to a scenario file, returns its path.
+func writeScenario(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"invalid yaml", "steps: [", "yaml"},
+		{"invalid lid", "steps:\n  - lid: ajar\n", "step 1: invalid lid state 'ajar'"},
+		{"invalid bluetooth", "steps:\n  - bluetooth: maybe\n", "step 1: invalid bluetooth state 'maybe'"},
+		{"invalid power source", "steps:\n  - power: solar\n", "step 1: invalid power source 'solar'"},
+		{"device without name", "steps:\n  - lid: open\n  - devices:\n      - power: \"on\"\n", "step 2: device without name"},
+		{"invalid device power", "steps:\n  - devices:\n      - name: wlan0\n        power: dim\n", "step 1: invalid power state 'dim'"},
+		{"ethernet without name", "steps:\n  - ethernet:\n      - link: up\n", "step 1: ethernet device without name"},
+		{"invalid link", "steps:\n  - ethernet:\n      - name: eth0\n        link: sideways\n", "step 1: invalid link state 'sideways'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadScenario(writeScenario(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("LoadScenario() error = %v, want containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadScenarioMissingFile(t *testing.T) {
+	if _, err := LoadScenario(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("LoadScenario() of missing file succeeded")
+	}
+}
+
+func TestLoadScenarioSortsSteps(t *testing.T) {
+	path := writeScenario(t, `steps:
+  - at: 1h
+    lid: open
+  - at: 3s
+    lid: closed
+  - at: 0s
+    lid: open
+  - at: 3s
+    power: ac
+`)
+	scenario, err := LoadScenario(path)
+	if err != nil {
+		t.Fatalf("LoadScenario() failed: %v", err)
+	}
+	want := []Step{
+		{At: 0, Lid: "open"},
+		{At: 3 * time.Second, Lid: "closed"},
+		{At: 3 * time.Second, Power: "ac"},
+		{At: time.Hour, Lid: "open"},
+	}
+	if len(scenario.Steps) != len(want) {
+		t.Fatalf("LoadScenario() got %d steps, want %d", len(scenario.Steps), len(want))
+	}
+	for i, step := range scenario.Steps {
+		if step.At != want[i].At || step.Lid != want[i].Lid || step.Power != want[i].Power {
+			t.Errorf("step %d = %+v, want %+v", i, step, want[i])
+		}
+	}
+}
+
+func TestSimulatorAdvancesTimeline(t *testing.T) {
+	battery := 15
+	scenario := &Scenario{Steps: []Step{
+		{At: 0, Lid: "open", Devices: []DeviceStep{{Name: "wlan0", Power: "on", Network: "Office"}}},
+		{At: 10 * time.Second, Lid: "closed", Power: "battery", Battery: &battery},
+		{At: 20 * time.Second, Devices: []DeviceStep{{Name: "wlan0", Removed: true}}, Ethernet: []EthernetStep{{Name: "eth0", Link: "up"}}},
+		{At: 30 * time.Second, Devices: []DeviceStep{{Name: "wlan0"}}},
+	}}
+	clock := clocktest.NewFakeClock(time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+	s := NewSimulator(scenario, clock)
+
+	if lid, _ := s.GetLidState(); lid != service.LidOpen {
+		t.Errorf("GetLidState() at 0s = %v, want open", lid)
+	}
+	if network, _ := s.GetWlanNetwork("wlan0"); network != "Office" {
+		t.Errorf("GetWlanNetwork() at 0s = %q, want Office", network)
+	}
+
+	clock.Advance(9 * time.Second)
+	if lid, _ := s.GetLidState(); lid != service.LidOpen {
+		t.Errorf("GetLidState() at 9s = %v, want open", lid)
+	}
+
+	clock.Advance(time.Second)
+	if lid, _ := s.GetLidState(); lid != service.LidClosed {
+		t.Errorf("GetLidState() at 10s = %v, want closed", lid)
+	}
+	if power, _ := s.GetPowerState(); power.Source != service.PowerSourceBattery || power.Percentage != 15 {
+		t.Errorf("GetPowerState() at 10s = %s, want battery at 15%%", power.String())
+	}
+
+	// switching off forgets the network until switched on again
+	if err := s.SetWlanState("wlan0", service.WlanPowerOff); err != nil {
+		t.Fatalf("SetWlanState() failed: %v", err)
+	}
+	if network, _ := s.GetWlanNetwork("wlan0"); network != "" {
+		t.Errorf("GetWlanNetwork() of device off = %q, want none", network)
+	}
+
+	clock.Advance(10 * time.Second)
+	if devices, _ := s.GetWlanDevices(); len(devices) != 0 {
+		t.Errorf("GetWlanDevices() at 20s = %v, want none", devices)
+	}
+	if devices, _ := s.GetEthernetDevices(); len(devices) != 1 || devices[0].Link != service.EthernetLinkUp {
+		t.Errorf("GetEthernetDevices() at 20s = %v, want eth0 up", devices)
+	}
+	if err := s.SetWlanState("wlan0", service.WlanPowerOn); err == nil {
+		t.Errorf("SetWlanState() of removed device succeeded")
+	}
+
+	// a device plugged in again comes back switched off
+	clock.Advance(10 * time.Second)
+	if state, err := s.GetWlanState("wlan0"); err != nil || state != service.WlanPowerOff {
+		t.Errorf("GetWlanState() at 30s = %v, %v, want off", state, err)
+	}
+	if err := s.SetWlanState("wlan0", service.WlanPowerOn); err != nil {
+		t.Fatalf("SetWlanState() failed: %v", err)
+	}
+	if network, _ := s.GetWlanNetwork("wlan0"); network != "Office" {
+		t.Errorf("GetWlanNetwork() after switching on = %q, want Office", network)
+	}
+}